@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"file-organizer/organizer"
+)
+
+// printAnalysis writes an analysis as JSON or as tables. Long lists are
+// cut to top entries in tables; JSON has everything but the largest files
+// beyond top.
+func printAnalysis(a *organizer.Analysis, format string, top int) {
+	if format == outputJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(a)
+		return
+	}
+
+	fmt.Printf("%s: %d files, %s", a.Root, a.Files, formatBytes(a.Bytes))
+	if a.Errored > 0 {
+		fmt.Printf(" (%d could not be read)", a.Errored)
+	}
+	fmt.Println()
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	section := func(title string) {
+		_ = tw.Flush()
+		fmt.Printf("\n%s\n", title)
+	}
+
+	section("By category")
+	printStats(tw, "CATEGORY", a.Categories, len(a.Categories))
+
+	section("By extension")
+	printStats(tw, "EXTENSION", a.Extensions, top)
+
+	section(`Unknown extensions (filed under "Other")`)
+	if len(a.Unknown) == 0 {
+		fmt.Println("None.")
+	} else {
+		printStats(tw, "EXTENSION", a.Unknown, top)
+	}
+
+	section("By age (last modified)")
+	fmt.Fprintln(tw, "AGE\tFILES\tSIZE")
+	for _, b := range a.Ages {
+		fmt.Fprintf(tw, "%s\t%d\t%s\n", b.Label, b.Files, formatBytes(b.Bytes))
+	}
+
+	section("Largest files")
+	fmt.Fprintln(tw, "SIZE\tCATEGORY\tPATH")
+	for _, f := range a.Largest {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", formatBytes(f.Size), f.Category, f.Path)
+	}
+
+	section("Probable duplicates")
+	if len(a.Duplicates) == 0 {
+		fmt.Println("None.")
+	}
+	var wasted int64
+	for i, d := range a.Duplicates {
+		wasted += d.Wasted()
+		if i >= top {
+			continue
+		}
+		_ = tw.Flush()
+		fmt.Printf("%d copies of %s (%s wasted):\n", len(d.Paths), formatBytes(d.Size), formatBytes(d.Wasted()))
+		for _, p := range d.Paths {
+			fmt.Printf("  %s\n", p)
+		}
+	}
+	if n := len(a.Duplicates); n > 0 {
+		if n > top {
+			fmt.Printf("... and %d more sets\n", n-top)
+		}
+		fmt.Printf("%s could be reclaimed with -dedupe\n", formatBytes(wasted))
+	}
+	_ = tw.Flush()
+}
+
+// printStats prints up to max rows of a stats table.
+func printStats(w io.Writer, title string, stats []organizer.Stat, max int) {
+	fmt.Fprintf(w, "%s\tFILES\tSIZE\n", title)
+	for i, s := range stats {
+		if i == max {
+			fmt.Fprintf(w, "(%d more)\n", len(stats)-max)
+			break
+		}
+		name := s.Name
+		if name == "" {
+			name = "(none)"
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\n", name, s.Files, formatBytes(s.Bytes))
+	}
+}
@@ -1,3 +1,10 @@
 module file-organizer
 
 go 1.25.0
+
+require (
+	github.com/fsnotify/fsnotify v1.10.1
+	github.com/pelletier/go-toml/v2 v2.2.2
+	golang.org/x/sys v0.13.0
+	gopkg.in/yaml.v3 v3.0.1
+)
@@ -1,75 +1,69 @@
+// Command file-organizer sorts the files of a directory into category
+// folders. It is a thin command-line wrapper over package organizer.
 package main
 
 import (
 	"context"
-	"encoding/json"
 	"flag"
 	"fmt"
-	"io"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strings"
-	"sync"
+	"syscall"
+	"text/tabwriter"
 	"time"
-)
-
-// Simple extension -> category mapping.
-// You can expand this over time; unknowns fall into "Other".
-var extToCategory = map[string]string{
-	// Images
-	".jpg": "Images", ".jpeg": "Images", ".png": "Images", ".gif": "Images",
-	".webp": "Images", ".bmp": "Images", ".tiff": "Images", ".heic": "Images",
-
-	// Video
-	".mp4": "Video", ".mov": "Video", ".mkv": "Video", ".avi": "Video",
-	".wmv": "Video", ".flv": "Video", ".webm": "Video",
-
-	// Audio
-	".mp3": "Audio", ".wav": "Audio", ".aac": "Audio", ".flac": "Audio",
-	".m4a": "Audio", ".ogg": "Audio",
-
-	// Docs
-	".pdf": "Docs", ".doc": "Docs", ".docx": "Docs", ".xls": "Docs",
-	".xlsx": "Docs", ".ppt": "Docs", ".pptx": "Docs",
-	".txt": "Docs", ".rtf": "Docs", ".md": "Docs", ".csv": "Docs",
-
-	// Archives
-	".zip": "Archives", ".rar": "Archives", ".7z": "Archives", ".gz": "Archives",
-	".tar": "Archives",
-
-	// Code
-	".go": "Code", ".cs": "Code", ".js": "Code", ".ts": "Code", ".jsx": "Code",
-	".tsx": "Code", ".py": "Code", ".java": "Code", ".rb": "Code",
-	".php": "Code", ".c": "Code", ".cpp": "Code", ".h": "Code", ".hpp": "Code",
-}
-
-type job struct {
-	srcPath string
-	info    os.FileInfo
-}
 
-type result struct {
-	srcPath string
-	dstPath string
-	err     error
-	action  string // "move" or "skip"
-}
-
-// Move record for manifest/undo
-type Move struct {
-	Src  string    `json:"src"`
-	Dst  string    `json:"dst"`
-	When time.Time `json:"when"`
-}
+	"file-organizer/organizer"
+)
 
 func main() {
 	var (
-		srcDir        string
-		dstDir        string
-		dryRun        bool
-		workers       int
-		includeHidden bool
-		undoManifest  string
+		srcDir         string
+		dstDir         string
+		dryRun         bool
+		workers        int
+		includeHidden  bool
+		undoManifest   string
+		recoverPath    string
+		rulesPath      string
+		sniff          bool
+		fixExt         bool
+		layoutTmpl     string
+		dateFrom       string
+		dedupe         string
+		onConflict     string
+		watch          bool
+		settle         time.Duration
+		mode           string
+		includes       stringList
+		excludes       stringList
+		maxDepth       int
+		minSize        string
+		maxSize        string
+		olderThan      string
+		newerThan      string
+		sinceLastRun   bool
+		statePath      string
+		markers        stringList
+		noProjects     bool
+		noSidecars     bool
+		output         string
+		planOut        string
+		undoCats       stringList
+		undoGlobs      stringList
+		undoSince      string
+		undoUntil      string
+		force          bool
+		undoLast       int
+		verbose        bool
+		reportPath     string
+		top            int
+		retention      stringList
+		extract        bool
+		extractOrig    string
+		extractReclass bool
+		extractMax     string
 	)
 
 	flag.StringVar(&srcDir, "src", ".", "Source directory to organize")
@@ -77,404 +71,354 @@ func main() {
 	flag.BoolVar(&dryRun, "dry-run", false, "Print actions without making changes")
 	flag.IntVar(&workers, "workers", 8, "Number of worker goroutines")
 	flag.BoolVar(&includeHidden, "include-hidden", false, "Include hidden files (.* on Unix)")
-	flag.StringVar(&undoManifest, "undo", "", "Undo using the given manifest JSON and exit")
+	flag.StringVar(&undoManifest, "undo", "", "Undo using the given manifest (JSONL journal or legacy JSON) and exit")
+	flag.Var(&undoCats, "undo-category", "With -undo or -undo-last, only undo files filed under this category (repeatable)")
+	flag.Var(&undoGlobs, "undo-glob", "With -undo or -undo-last, only undo files whose source or destination matches this gitignore-style glob (repeatable)")
+	flag.StringVar(&undoSince, "undo-since", "", "With -undo or -undo-last, only undo changes made at or after this age or date (e.g. 2h, 2024-01-31)")
+	flag.StringVar(&undoUntil, "undo-until", "", "With -undo or -undo-last, only undo changes made before this age or date")
+	flag.BoolVar(&force, "force", false, "Undo files even if they were modified since they were organized")
+	flag.IntVar(&undoLast, "undo-last", 0, "Undo the newest N runs recorded under -dest, newest first, and exit")
+	flag.StringVar(&recoverPath, "recover", "", "Finish or roll back changes left in flight in the given journal and exit")
+	flag.StringVar(&rulesPath, "rules", "", "Load category rules from a YAML/JSON/TOML file")
+	flag.BoolVar(&sniff, "sniff", false, "Detect file types from content when the extension is missing or wrong")
+	flag.BoolVar(&fixExt, "fix-ext", false, "With -sniff, add or correct the extension when moving")
+	flag.StringVar(&layoutTmpl, "layout", organizer.DefaultLayout, "Destination path template, e.g. {category}/{year}/{month}/{name}{ext} or {category}/{camera}/{exif.year}/{name}{ext}")
+	flag.StringVar(&dateFrom, "date-from", organizer.DateFromAuto, "Date source for {year}/{month}/{day}: auto, mtime, name or meta")
+	flag.StringVar(&dedupe, "dedupe", "", "Detect duplicate content: skip, delete-source, hardlink or move-to (Duplicates/)")
+	flag.BoolVar(&watch, "watch", false, "Keep running and organize new files as they arrive (stop with SIGINT/SIGTERM)")
+	flag.DurationVar(&settle, "settle", 5*time.Second, "With -watch, how long a file must stay unchanged before it is moved")
+	flag.StringVar(&onConflict, "on-conflict", organizer.ConflictRename, "When the target exists: rename, skip, overwrite, keep-newer, keep-larger or hash-compare")
+	flag.StringVar(&mode, "mode", organizer.ModeMove, "How files are placed: move, copy, symlink or hardlink")
+	flag.Var(&includes, "include", "Only organize files matching this gitignore-style glob (repeatable)")
+	flag.Var(&excludes, "exclude", "Skip paths matching this gitignore-style pattern (repeatable); .organizerignore files are honored too")
+	flag.IntVar(&maxDepth, "max-depth", -1, "How many directory levels below -src to descend (-1 = unlimited, 0 = top level only)")
+	flag.StringVar(&minSize, "min-size", "", "Skip files smaller than this (e.g. 10KB, 1.5MB)")
+	flag.StringVar(&maxSize, "max-size", "", "Skip files larger than this (e.g. 2GB)")
+	flag.StringVar(&olderThan, "older-than", "", "Only files modified before this age or date (e.g. 30d, 2w, 2024-01-31)")
+	flag.StringVar(&newerThan, "newer-than", "", "Only files modified after this age or date (e.g. 12h, 7d, 2024-01-31)")
+	flag.BoolVar(&sinceLastRun, "modified-since-last-run", false, "Only files modified since the last run over -src (see -state-file)")
+	flag.StringVar(&statePath, "state-file", "", "State file recording last runs (default: <dest>/.organizer-manifests/state.json)")
+	flag.Var(&markers, "project-marker", "Treat directories containing an entry matching this glob as projects, in addition to .git, go.mod, package.json and *.xcodeproj (repeatable)")
+	flag.BoolVar(&noProjects, "no-projects", false, "Don't detect project directories; organize their files individually")
+	flag.BoolVar(&noSidecars, "no-sidecars", false, "Don't keep sidecar files (.xmp, .srt, RAW+JPG pairs) with their primary file")
+	flag.StringVar(&output, "output", outputText, "Output format: text, json (one document at the end) or ndjson (one event per line)")
+	flag.StringVar(&planOut, "out", "plan.json", "With plan: where to write the plan")
+	flag.StringVar(&reportPath, "report", "", "After the run, write a report for sharing to this .html or .csv file")
+	flag.IntVar(&top, "top", 10, "With analyze: how many of the largest files, extensions and duplicate sets to list")
+	flag.Var(&retention, "retention", `After organizing, move files of a category older than an age to <dest>/.organizer-trash, e.g. "Archives older than 30d -> trash" (repeatable)`)
+	flag.BoolVar(&extract, "extract", false, "Unpack .zip, .tar, .tar.gz/.tgz and .gz files sorted into Archives into a folder beside them (Archives/<name>/)")
+	flag.StringVar(&extractOrig, "extract-originals", organizer.ExtractKeep, "With -extract, what happens to an archive once unpacked: keep or trash (to <dest>/.organizer-trash)")
+	flag.BoolVar(&extractReclass, "extract-reclassify", false, "With -extract, organize the unpacked files like any other")
+	flag.StringVar(&extractMax, "extract-max-size", "", "With -extract, refuse archives that unpack to more than this (default 8GB)")
+	flag.BoolVar(&verbose, "v", false, "On a terminal, print a line per file as well as the progress line")
+
+	// Subcommands: "plan" is a dry run that saves what it would do for
+	// review, "apply" carries out a saved (possibly edited) plan,
+	// "history" lists the runs recorded under -dest, "analyze"
+	// describes what -src holds without changing anything, and "trash"
+	// lists, restores or empties what retention rules expired.
+	cmd := ""
+	if len(os.Args) > 1 && (os.Args[1] == "plan" || os.Args[1] == "apply" || os.Args[1] == "history" || os.Args[1] == "analyze" || os.Args[1] == "trash") {
+		cmd = os.Args[1]
+		os.Args = append(os.Args[:1], os.Args[2:]...)
+	}
 	flag.Parse()
 
+	var plan *organizer.Plan
+	var trashCmd string
+	switch cmd {
+	case "plan":
+		dryRun = true
+	case "apply":
+		if flag.NArg() < 1 {
+			exitf("usage: %s apply [flags] plan.json", filepath.Base(os.Args[0]))
+		}
+		planPath := flag.Arg(0)
+		// Allow flags after the plan path too
+		if err := flag.CommandLine.Parse(flag.Args()[1:]); err != nil {
+			exitf("%v", err)
+		}
+		var err error
+		if plan, err = organizer.LoadPlan(planPath); err != nil {
+			exitf("%v", err)
+		}
+		mode = plan.Mode
+	case "trash":
+		if flag.NArg() < 1 {
+			exitf("usage: %s trash list|restore|empty [flags] [names]", filepath.Base(os.Args[0]))
+		}
+		trashCmd = flag.Arg(0)
+		if err := flag.CommandLine.Parse(flag.Args()[1:]); err != nil {
+			exitf("%v", err)
+		}
+	}
+	if cmd != "" && watch {
+		exitf("-watch can't be combined with %s", cmd)
+	}
+	if !validOutput(output) {
+		exitf("invalid -output %q (want text, json or ndjson)", output)
+	}
+	if cmd == "analyze" && (output == outputNDJSON || reportPath != "" || top < 1) {
+		exitf("analyze takes -output text or json, no -report, and -top of at least 1")
+	}
+	if reportPath != "" && !validReport(reportPath) {
+		exitf("invalid -report %q (want a .html or .csv file)", reportPath)
+	}
+
 	if dstDir == "" {
 		dstDir = srcDir
 	}
 
-	// Validate source; we allow undo to run without a dest check.
-	mustBeDir(srcDir)
-
-	// Undo mode short-circuit
-	if undoManifest != "" {
-		if err := undoFromManifest(undoManifest, dryRun); err != nil {
-			fmt.Fprintf(os.Stderr, "undo failed: %v\n", err)
-			os.Exit(1)
+	rules := organizer.DefaultRules()
+	if rulesPath != "" {
+		var err error
+		if rules, err = organizer.LoadRules(rulesPath); err != nil {
+			exitf("%v", err)
 		}
-		return
 	}
 
-	// Normal run: validate dest too
-	mustBeDir(dstDir)
-
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-
-	// Producer/consumer channels
-	jobs := make(chan job, 256)
-	results := make(chan result, 256)
-
-	// Start workers
-	var wg sync.WaitGroup
-	for i := 0; i < workers; i++ {
-		wg.Add(1)
-		go worker(ctx, &wg, jobs, results, dstDir, dryRun)
+	// Recover mode short-circuit
+	if recoverPath != "" {
+		if err := organizer.Recover(recoverPath, dryRun, os.Stdout); err != nil {
+			exitf("recover failed: %v", err)
+		}
+		return
 	}
 
-	// Walk in a separate goroutine so we can consume results concurrently
-	go func() {
-		defer close(jobs)
-		_ = filepath.Walk(srcDir, func(path string, info os.FileInfo, err error) error {
-			if err != nil {
-				results <- result{srcPath: path, err: err}
-				return nil
-			}
-			// Skip directories
-			if info.IsDir() {
-				return nil
-			}
-			// Optional: skip hidden files
-			if !includeHidden && isHidden(info) {
-				return nil
-			}
-			// Skip files already under a categorized subfolder of dst
-			// (prevents re-moving if src==dst)
-			if inCategorizedSubfolder(dstDir, path) {
-				return nil
-			}
-
-			jobs <- job{srcPath: path, info: info}
-			return nil
-		})
-	}()
-
-	// Collector: close results when workers finish
-	go func() {
-		wg.Wait()
-		close(results)
-	}()
-
-	var moved, skipped, failed int
-	var moves []Move
-	start := time.Now()
-
-	for r := range results {
-		if r.err != nil {
-			failed++
-			fmt.Printf("ERROR  %s -> %s  (%v)\n", r.srcPath, r.dstPath, r.err)
-			continue
+	// Undo mode short-circuit
+	if undoManifest != "" || undoLast > 0 {
+		opts := organizer.UndoOptions{DryRun: dryRun, Force: force, Categories: undoCats, Globs: undoGlobs, Classifier: rules}
+		var err error
+		if opts.Since, err = organizer.ParseAgeCutoff(undoSince, time.Now()); err != nil {
+			exitf("-undo-since: %v", err)
 		}
-		switch r.action {
-		case "move":
-			moved++
-			if dryRun {
-				fmt.Printf("DRYRUN %s -> %s\n", r.srcPath, r.dstPath)
-			} else {
-				fmt.Printf("MOVED  %s -> %s\n", r.srcPath, r.dstPath)
-				moves = append(moves, Move{Src: r.srcPath, Dst: r.dstPath, When: time.Now()})
-			}
-		case "skip":
-			skipped++
-			fmt.Printf("SKIP   %s\n", r.srcPath)
-		default:
-			// no-op
+		if opts.Until, err = organizer.ParseAgeCutoff(undoUntil, time.Now()); err != nil {
+			exitf("-undo-until: %v", err)
 		}
-	}
-
-	// Write manifest for undo
-	if !dryRun && len(moves) > 0 {
-		if mf, err := writeManifest(dstDir, moves); err != nil {
-			fmt.Printf("WARN   failed to write manifest: %v\n", err)
+		if undoManifest != "" {
+			err = organizer.Undo(undoManifest, opts)
 		} else {
-			fmt.Printf("Manifest saved: %s\n", mf)
+			err = organizer.UndoLast(dstDir, undoLast, opts)
 		}
-	}
-
-	elapsed := time.Since(start).Truncate(time.Millisecond)
-	fmt.Printf("\nDone in %s | moved=%d skipped=%d failed=%d\n", elapsed, moved, skipped, failed)
-}
-
-func worker(
-	ctx context.Context,
-	wg *sync.WaitGroup,
-	jobs <-chan job,
-	results chan<- result,
-	dstRoot string,
-	dryRun bool,
-) {
-	defer wg.Done()
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		case j, ok := <-jobs:
-			if !ok {
-				return
-			}
-			r := handleJob(j, dstRoot, dryRun)
-			results <- r
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "undo failed: %v\n", err)
+			os.Exit(1)
 		}
+		return
 	}
-}
 
-func handleJob(j job, dstRoot string, dryRun bool) result {
-	ext := strings.ToLower(filepath.Ext(j.info.Name()))
-	category, ok := extToCategory[ext]
-	if !ok || category == "" {
-		category = "Other"
+	if cmd == "history" {
+		runs, err := organizer.Runs(dstDir)
+		if err != nil {
+			exitf("%v", err)
+		}
+		printHistory(runs)
+		return
 	}
 
-	// Compute destination folder and filename
-	dstDir := filepath.Join(dstRoot, category)
-	dstPath := filepath.Join(dstDir, j.info.Name())
-
-	// If the source and destination are the same path, skip
-	if sameFile(j.srcPath, dstPath) {
-		return result{srcPath: j.srcPath, dstPath: dstPath, action: "skip"}
+	if cmd == "trash" {
+		runTrash(trashCmd, dstDir, flag.Args(), olderThan, dryRun, output)
+		return
 	}
 
-	// Ensure destination directory exists
-	if !dryRun {
-		if err := os.MkdirAll(dstDir, 0o755); err != nil {
-			return result{srcPath: j.srcPath, dstPath: dstPath, err: err}
+	rep := newReporter(output, mode, dryRun, dedupe != "")
+	// A live progress line replaces the per-file lines on a terminal;
+	// dry runs are for reading what would happen, so they keep them.
+	if output == outputText && !watch && cmd != "analyze" && isTerminal(os.Stdout) {
+		rep.verbose = verbose || dryRun
+		rep.showProgress(os.Stdout)
+	}
+	if reportPath != "" {
+		rep.report = newRunReport()
+	}
+	opts := []organizer.Option{
+		organizer.WithDryRun(dryRun),
+		organizer.WithWorkers(workers),
+		organizer.WithIncludeHidden(includeHidden),
+		organizer.WithRules(rules),
+		organizer.WithLayout(layoutTmpl),
+		organizer.WithDateFrom(dateFrom),
+		organizer.WithDedupe(dedupe),
+		organizer.WithConflictPolicy(onConflict),
+		organizer.WithMode(mode),
+		organizer.WithIncludes(includes...),
+		organizer.WithExcludes(excludes...),
+		organizer.WithMaxDepth(maxDepth),
+		organizer.WithStateFile(statePath),
+		organizer.WithProjectMarkers(markers...),
+		organizer.OnEvent(rep.add),
+		organizer.OnDiscover(rep.discover),
+		organizer.WithLog(rep.log),
+	}
+	if sniff {
+		opts = append(opts, organizer.WithSniff(fixExt))
+	}
+	var minBytes, maxBytes int64
+	var err error
+	if minSize != "" {
+		if minBytes, err = organizer.ParseSize(minSize); err != nil {
+			exitf("-min-size: %v", err)
 		}
 	}
-
-	// Resolve name conflicts
-	if !dryRun {
-		if exists(dstPath) {
-			var err error
-			dstPath, err = nextAvailableName(dstPath)
-			if err != nil {
-				return result{srcPath: j.srcPath, dstPath: dstPath, err: err}
-			}
+	if maxSize != "" {
+		if maxBytes, err = organizer.ParseSize(maxSize); err != nil {
+			exitf("-max-size: %v", err)
 		}
 	}
-
-	// Move (or simulate)
-	if dryRun {
-		return result{srcPath: j.srcPath, dstPath: dstPath, action: "move"}
-	}
-
-	if err := moveFile(j.srcPath, dstPath); err != nil {
-		return result{srcPath: j.srcPath, dstPath: dstPath, err: err}
+	opts = append(opts, organizer.WithSizeRange(minBytes, maxBytes))
+	now := time.Now()
+	older, err := organizer.ParseAgeCutoff(olderThan, now)
+	if err != nil {
+		exitf("-older-than: %v", err)
 	}
-	return result{srcPath: j.srcPath, dstPath: dstPath, action: "move"}
-}
-
-func mustBeDir(path string) {
-	info, err := os.Stat(path)
+	newer, err := organizer.ParseAgeCutoff(newerThan, now)
 	if err != nil {
-		exitf("path %q: %v", path, err)
+		exitf("-newer-than: %v", err)
 	}
-	if !info.IsDir() {
-		exitf("%q is not a directory", path)
+	opts = append(opts, organizer.WithModTimeRange(newer, older))
+	if sinceLastRun {
+		opts = append(opts, organizer.WithSinceLastRun())
 	}
-}
-
-func exitf(format string, a ...any) {
-	_, _ = fmt.Fprintf(os.Stderr, format+"\n", a...)
-	os.Exit(1)
-}
-
-// Returns true if path is inside dstRoot/<any-known-category>/...
-func inCategorizedSubfolder(dstRoot, path string) bool {
-	absRoot, _ := filepath.Abs(dstRoot)
-	absPath, _ := filepath.Abs(path)
-
-	rel, err := filepath.Rel(absRoot, absPath)
-	if err != nil || strings.HasPrefix(rel, "..") {
-		return false
+	if noProjects {
+		opts = append(opts, organizer.WithoutProjects())
 	}
-
-	first := strings.Split(rel, string(filepath.Separator))[0]
-	if first == "." || first == "" {
-		return false
+	if noSidecars {
+		opts = append(opts, organizer.WithoutSidecars())
 	}
-
-	for _, cat := range []string{"Images", "Video", "Audio", "Docs", "Archives", "Code", "Other"} {
-		if first == cat {
-			return true
-		}
+	if watch {
+		opts = append(opts, organizer.WithWatch(settle))
 	}
-	return false
-}
-
-func exists(path string) bool {
-	_, err := os.Stat(path)
-	return err == nil
-}
-
-func sameFile(a, b string) bool {
-	absA, _ := filepath.Abs(a)
-	absB, _ := filepath.Abs(b)
-	return absA == absB
-}
-
-func nextAvailableName(path string) (string, error) {
-	dir := filepath.Dir(path)
-	base := filepath.Base(path)
-	ext := filepath.Ext(base)
-	name := strings.TrimSuffix(base, ext)
-
-	for i := 1; i < 10_000; i++ {
-		candidate := filepath.Join(dir, fmt.Sprintf("%s (%d)%s", name, i, ext))
-		if !exists(candidate) {
-			return candidate, nil
-		}
+	if plan != nil {
+		opts = append(opts, organizer.WithPlan(plan))
 	}
-	return "", fmt.Errorf("too many name conflicts for %q", path)
-}
-
-// moveFile attempts a fast rename; if crossing devices, it falls back to copy+remove.
-func moveFile(src, dst string) error {
-	// try rename
-	if err := os.Rename(src, dst); err == nil {
-		return nil
+	if extract {
+		opts = append(opts, organizer.WithExtract(extractOrig, extractReclass))
+		if extractMax != "" {
+			n, err := organizer.ParseSize(extractMax)
+			if err != nil {
+				exitf("-extract-max-size: %v", err)
+			}
+			opts = append(opts, organizer.WithExtractLimits(n, 0))
+		}
 	}
-
-	// fallback: copy then remove
-	if err := copyFile(src, dst); err != nil {
-		return err
+	for _, s := range retention {
+		r, err := organizer.ParseRetentionRule(s)
+		if err != nil {
+			exitf("-retention: %v", err)
+		}
+		opts = append(opts, organizer.WithRetention(r))
 	}
-	return os.Remove(src)
-}
-
-func copyFile(src, dst string) error {
-	in, err := os.Open(src)
+	org, err := organizer.New(srcDir, dstDir, opts...)
 	if err != nil {
-		return err
+		exitf("%v", err)
 	}
-	defer func(in *os.File) {
-		_ = in.Close()
-	}(in)
 
-	// Create with same perms as source when possible
-	info, err := in.Stat()
-	if err != nil {
-		return err
-	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
-	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, info.Mode())
-	if err != nil {
-		return err
-	}
-	defer func() {
-		_ = out.Close()
+	// SIGINT/SIGTERM stop the walk (or the watcher) and any work not yet
+	// started; changes in flight finish and are journaled as usual. A
+	// second signal kills the process, which -recover can clean up after.
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	interrupted := make(chan os.Signal, 1)
+	go func() {
+		select {
+		case s := <-sigs:
+			signal.Stop(sigs)
+			if !watch {
+				rep.logf("\nInterrupted: finishing changes in flight (signal again to quit at once)")
+			}
+			interrupted <- s
+			cancel()
+		case <-ctx.Done():
+		}
 	}()
 
-	if _, err := io.Copy(out, in); err != nil {
-		return err
-	}
-	return nil
-}
-
-// isHidden: on Unix, files starting with '.'; on Windows, this is a naive check.
-// (You can improve Windows detection using syscall attributes in a future iteration.)
-func isHidden(info os.FileInfo) bool {
-	name := info.Name()
-	return strings.HasPrefix(name, ".")
-}
-
-// ----- Manifest & Undo -----
-
-func writeManifest(dstRoot string, moves []Move) (string, error) {
-	if len(moves) == 0 {
-		return "", nil
-	}
-	dir := filepath.Join(dstRoot, ".organizer-manifests")
-	if err := os.MkdirAll(dir, 0o755); err != nil {
-		return "", err
+	if cmd == "analyze" {
+		a, err := org.Analyze(ctx, top)
+		if err != nil {
+			exitf("%v", err)
+		}
+		printAnalysis(a, output, top)
+		return
 	}
 
-	name := fmt.Sprintf("moves-%s.json", time.Now().Format("20060102-150405"))
-	path := filepath.Join(dir, name)
-
-	f, err := os.Create(path)
+	sum, err := org.Run(ctx)
 	if err != nil {
-		return "", err
+		exitf("%v", err)
 	}
-	defer f.Close()
 
-	enc := json.NewEncoder(f)
-	enc.SetIndent("", "  ")
-	if err := enc.Encode(moves); err != nil {
-		return "", err
+	if cmd == "plan" && sum.Plan == nil {
+		rep.logf("Plan not saved: the walk was interrupted")
+	} else if cmd == "plan" {
+		if err := sum.Plan.Write(planOut); err != nil {
+			exitf("writing plan: %v", err)
+		}
+		rep.logf("Plan saved: %s (%d entries)", planOut, len(sum.Plan.Entries))
 	}
-	return path, nil
-}
-
-func undoFromManifest(manifest string, dryRun bool) error {
-	f, err := os.Open(manifest)
-	if err != nil {
-		return err
+	if sum.Manifest != "" {
+		rep.logf("Manifest saved: %s", sum.Manifest)
 	}
-	defer f.Close()
-
-	var moves []Move
-	if err := json.NewDecoder(f).Decode(&moves); err != nil {
-		return err
+	if rep.report != nil {
+		src, dst := srcDir, dstDir
+		if plan != nil {
+			src, dst = plan.Src, plan.Dest
+		}
+		if err := writeReport(reportPath, rep.report.data(src, dst, mode, dryRun, sum)); err != nil {
+			rep.logf("WARN   failed to write report: %v", err)
+		} else {
+			rep.logf("Report saved: %s", reportPath)
+		}
 	}
 
-	var undone, skipped, failed int
-	// Reverse order to safely unwind nested moves
-	for i := len(moves) - 1; i >= 0; i-- {
-		m := moves[i]
-		if !exists(m.Dst) {
-			fmt.Printf("SKIP   missing: %s (already moved/deleted)\n", m.Dst)
-			skipped++
-			continue
-		}
-		target := m.Src
-		if exists(target) {
-			// Don’t clobber anything that reappeared at the original location
-			var err error
-			target, err = nextAvailableName(target)
-			if err != nil {
-				fmt.Printf("ERROR  undo %s -> %s (%v)\n", m.Dst, target, err)
-				failed++
-				continue
+	rep.finish(sum)
+	if sum.Interrupted {
+		// Shell convention: 128 + signal number
+		code := 130
+		select {
+		case s := <-interrupted:
+			if s == syscall.SIGTERM {
+				code = 143
 			}
+		default:
 		}
-		if dryRun {
-			fmt.Printf("DRYRUN UNDO %s -> %s\n", m.Dst, target)
-			undone++
-			continue
-		}
-		if err := moveFile(m.Dst, target); err != nil {
-			fmt.Printf("ERROR  undo %s -> %s (%v)\n", m.Dst, target, err)
-			failed++
-			continue
-		}
-		fmt.Printf("UNDONE %s -> %s\n", m.Dst, target)
-		undone++
-	}
-	fmt.Printf("\nUndo summary: undone=%d skipped=%d failed=%d\n", undone, skipped, failed)
-	// Try to remove empty category dirs in the directory that contained the manifest.
-	if !dryRun {
-		// derive dstRoot from manifest path
-		if root := filepath.Dir(filepath.Dir(manifest)); root != "" {
-			removeEmptyCategoryDirs(root)
-		}
+		os.Exit(code)
 	}
-	return nil
 }
 
-// removeEmptyCategoryDirs deletes empty category folders under dstRoot.
-// Safe: only removes the known category directories if they are empty.
-func removeEmptyCategoryDirs(dstRoot string) {
-	cats := []string{"Images", "Video", "Audio", "Docs", "Archives", "Code", "Other"}
-	for _, c := range cats {
-		dir := filepath.Join(dstRoot, c)
-		// Only attempt if the dir exists
-		if fi, err := os.Stat(dir); err == nil && fi.IsDir() {
-			// Check emptiness
-			empty := true
-			_ = filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
-				if err != nil {
-					return nil
-				}
-				if p != dir {
-					empty = false
-					return fmt.Errorf("stop")
-				} // early stop
-				return nil
-			})
-			if empty {
-				_ = os.Remove(dir) // remove empty dir
-			}
+// printHistory lists runs newest first, numbered the way -undo-last
+// counts them.
+func printHistory(runs []organizer.Run) {
+	if len(runs) == 0 {
+		fmt.Println("No runs recorded.")
+		return
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "#\tSTARTED\tPLACED\tDUPLICATES\tEXTRACTED\tTRASHED\tUNDONE\tMANIFEST")
+	for i := len(runs) - 1; i >= 0; i-- {
+		r := runs[i]
+		undone := fmt.Sprint(r.Undone)
+		if r.InFlight > 0 {
+			undone += fmt.Sprintf(" (%d in flight)", r.InFlight)
 		}
+		fmt.Fprintf(tw, "%d\t%s\t%d\t%d\t%d\t%d\t%s\t%s\n", len(runs)-i, r.Started.Local().Format("2006-01-02 15:04:05"),
+			r.Placed, r.Duplicates, r.Extracted, r.Trashed, undone, filepath.Base(r.Manifest))
 	}
+	_ = tw.Flush()
+}
+
+func exitf(format string, a ...any) {
+	_, _ = fmt.Fprintf(os.Stderr, format+"\n", a...)
+	os.Exit(1)
+}
+
+// stringList is a repeatable string flag (--exclude a --exclude b).
+type stringList []string
+
+func (s *stringList) String() string { return strings.Join(*s, ",") }
+
+func (s *stringList) Set(v string) error {
+	*s = append(*s, v)
+	return nil
 }
@@ -0,0 +1,256 @@
+package organizer
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Analysis describes a source tree as Run would see it: the same walk,
+// filters and classification, with nothing moved.
+type Analysis struct {
+	Root    string `json:"root"`
+	Files   int    `json:"files"` // projects count as one file each
+	Bytes   int64  `json:"bytes"`
+	Errored int    `json:"errors"` // paths that could not be read
+
+	Categories []Stat      `json:"categories"` // largest first
+	Extensions []Stat      `json:"extensions"` // largest first; "" is no extension
+	Unknown    []Stat      `json:"unknown"`    // extensions that fall into Other
+	Ages       []AgeBucket `json:"ages"`       // by modification time, newest first
+	Largest    []FileStat  `json:"largest"`
+
+	// Duplicates are sets of files with identical content, most space
+	// wasted first. They are probable: files may change after hashing.
+	Duplicates []DuplicateSet `json:"duplicates"`
+}
+
+// Stat counts the files and bytes of a category or extension.
+type Stat struct {
+	Name  string `json:"name"`
+	Files int    `json:"files"`
+	Bytes int64  `json:"bytes"`
+}
+
+// AgeBucket counts files last modified within an age range.
+type AgeBucket struct {
+	Label string        `json:"label"`
+	Max   time.Duration `json:"max_ns,omitempty"` // 0 for the oldest bucket
+	Files int           `json:"files"`
+	Bytes int64         `json:"bytes"`
+}
+
+// FileStat is one file (or project) of an Analysis.
+type FileStat struct {
+	Path     string    `json:"path"`
+	Size     int64     `json:"size"`
+	Category string    `json:"category"`
+	ModTime  time.Time `json:"mod_time"`
+}
+
+// DuplicateSet is a group of files with the same content.
+type DuplicateSet struct {
+	Size  int64    `json:"size"`
+	Paths []string `json:"paths"`
+}
+
+// Wasted is the space the copies beyond the first take.
+func (d DuplicateSet) Wasted() int64 {
+	return d.Size * int64(len(d.Paths)-1)
+}
+
+// ageBuckets are the Analysis.Ages ranges, newest first.
+var ageBuckets = []AgeBucket{
+	{Label: "< 1 day", Max: 24 * time.Hour},
+	{Label: "1-7 days", Max: 7 * 24 * time.Hour},
+	{Label: "1-4 weeks", Max: 30 * 24 * time.Hour},
+	{Label: "1-12 months", Max: 365 * 24 * time.Hour},
+	{Label: "1-3 years", Max: 3 * 365 * 24 * time.Hour},
+	{Label: "> 3 years"},
+}
+
+// analyzer accumulates an Analysis from walked jobs.
+type analyzer struct {
+	cfg        *config
+	top        int
+	now        time.Time
+	a          Analysis
+	categories map[string]*Stat
+	extensions map[string]*Stat
+	unknown    map[string]*Stat
+	bySize     map[int64][]string
+}
+
+// Analyze walks the source like Run and reports what is there, listing
+// the top largest files. It never changes anything; options that only
+// affect placement are ignored.
+func (o *Organizer) Analyze(ctx context.Context, top int) (*Analysis, error) {
+	if o.plan != nil {
+		return nil, errors.New("a plan can't be analyzed")
+	}
+	cfg, _, _, err := o.newConfig()
+	if err != nil {
+		return nil, err
+	}
+	an := &analyzer{cfg: cfg, top: top, now: time.Now(), a: Analysis{Root: absPath(o.src)},
+		categories: make(map[string]*Stat), extensions: make(map[string]*Stat), unknown: make(map[string]*Stat),
+		bySize: make(map[int64][]string)}
+	an.a.Ages = append([]AgeBucket(nil), ageBuckets...)
+
+	jobs := make(chan job, 256)
+	results := make(chan result, 256)
+	go func() {
+		defer close(results)
+		defer close(jobs)
+		walkSource(ctx, o.src, cfg, jobs, results)
+	}()
+	for jobs != nil || results != nil {
+		select {
+		case j, ok := <-jobs:
+			if !ok {
+				jobs = nil
+				continue
+			}
+			an.add(j)
+		case _, ok := <-results:
+			if !ok {
+				results = nil
+				continue
+			}
+			an.a.Errored++
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	an.findDuplicates(ctx)
+	return an.finish(), ctx.Err()
+}
+
+func (an *analyzer) add(j job) {
+	if j.info.IsDir() {
+		size, _ := treeStamp(an.cfg.fs, j.srcPath)
+		an.count(j, projectsCategory, "", size)
+		return
+	}
+	category, _ := classify(an.cfg, j)
+	an.count(j, category, strings.ToLower(filepath.Ext(j.info.Name())), j.info.Size())
+	// Sidecars go wherever their primary goes
+	for _, s := range j.sidecars {
+		an.count(s, category, strings.ToLower(filepath.Ext(s.info.Name())), s.info.Size())
+	}
+}
+
+func (an *analyzer) count(j job, category, ext string, size int64) {
+	an.a.Files++
+	an.a.Bytes += size
+	addStat(an.categories, category, size)
+	if j.info.IsDir() {
+		an.largest(FileStat{Path: j.srcPath, Size: size, Category: category, ModTime: j.info.ModTime()})
+		return
+	}
+	addStat(an.extensions, ext, size)
+	if category == "Other" {
+		addStat(an.unknown, ext, size)
+	}
+	age := an.now.Sub(j.info.ModTime())
+	for i := range an.a.Ages {
+		if b := &an.a.Ages[i]; b.Max == 0 || age < b.Max {
+			b.Files++
+			b.Bytes += size
+			break
+		}
+	}
+	an.largest(FileStat{Path: j.srcPath, Size: size, Category: category, ModTime: j.info.ModTime()})
+	if j.info.Mode().IsRegular() && size > 0 {
+		an.bySize[size] = append(an.bySize[size], j.srcPath)
+	}
+}
+
+// largest keeps the top largest files, in order.
+func (an *analyzer) largest(f FileStat) {
+	l := an.a.Largest
+	i := sort.Search(len(l), func(i int) bool { return l[i].Size < f.Size })
+	if i >= an.top {
+		return
+	}
+	l = append(l, FileStat{})
+	copy(l[i+1:], l[i:])
+	l[i] = f
+	if len(l) > an.top {
+		l = l[:an.top]
+	}
+	an.a.Largest = l
+}
+
+// findDuplicates hashes the files that share a size with another one.
+func (an *analyzer) findDuplicates(ctx context.Context) {
+	for size, paths := range an.bySize {
+		if len(paths) < 2 {
+			continue
+		}
+		byHash := make(map[string][]string)
+		for _, p := range paths {
+			if ctx.Err() != nil {
+				return
+			}
+			if h, err := hashFile(an.cfg.fs, p); err == nil {
+				byHash[h] = append(byHash[h], p)
+			}
+		}
+		for _, ps := range byHash {
+			if len(ps) > 1 {
+				sort.Strings(ps)
+				an.a.Duplicates = append(an.a.Duplicates, DuplicateSet{Size: size, Paths: ps})
+			}
+		}
+	}
+	sort.Slice(an.a.Duplicates, func(i, j int) bool {
+		di, dj := an.a.Duplicates[i], an.a.Duplicates[j]
+		if di.Wasted() != dj.Wasted() {
+			return di.Wasted() > dj.Wasted()
+		}
+		return di.Paths[0] < dj.Paths[0]
+	})
+}
+
+func (an *analyzer) finish() *Analysis {
+	an.a.Categories = sortedStats(an.categories)
+	an.a.Extensions = sortedStats(an.extensions)
+	an.a.Unknown = sortedStats(an.unknown)
+	if an.a.Largest == nil {
+		an.a.Largest = []FileStat{}
+	}
+	if an.a.Duplicates == nil {
+		an.a.Duplicates = []DuplicateSet{}
+	}
+	return &an.a
+}
+
+func addStat(m map[string]*Stat, name string, size int64) {
+	s, ok := m[name]
+	if !ok {
+		s = &Stat{Name: name}
+		m[name] = s
+	}
+	s.Files++
+	s.Bytes += size
+}
+
+// sortedStats lists stats largest first, by bytes and then by name.
+func sortedStats(m map[string]*Stat) []Stat {
+	out := make([]Stat, 0, len(m))
+	for _, s := range m {
+		out = append(out, *s)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Bytes != out[j].Bytes {
+			return out[i].Bytes > out[j].Bytes
+		}
+		return out[i].Name < out[j].Name
+	})
+	return out
+}
@@ -0,0 +1,111 @@
+package organizer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Name-conflict policies (WithConflictPolicy, --on-conflict).
+const (
+	ConflictRename      = "rename"       // add " (n)" via nextAvailableName
+	ConflictSkip        = "skip"         // leave the source where it is
+	ConflictOverwrite   = "overwrite"    // replace the target (backed up first)
+	ConflictKeepNewer   = "keep-newer"   // overwrite only if the source is newer
+	ConflictKeepLarger  = "keep-larger"  // overwrite only if the source is larger
+	ConflictHashCompare = "hash-compare" // same content is a duplicate, otherwise rename
+)
+
+// actionOverwrite is the manifest action for a move that replaced an
+// existing target; Move.Backup holds the previous target.
+const actionOverwrite = "overwrite"
+
+// backupsDirName lives under the manifests folder, one subfolder per run.
+const backupsDirName = "backups"
+
+func validConflictPolicy(p string) bool {
+	switch p {
+	case ConflictRename, ConflictSkip, ConflictOverwrite, ConflictKeepNewer, ConflictKeepLarger, ConflictHashCompare:
+		return true
+	}
+	return false
+}
+
+// conflictDecision is what resolveConflict wants done with a job.
+type conflictDecision int
+
+const (
+	decideRename conflictDecision = iota
+	decideSkip
+	decideOverwrite
+	decideDuplicate
+)
+
+// resolveConflict applies the policy when dst already exists. For
+// decideRename it also returns the free name to use instead.
+func resolveConflict(fsys FS, policy string, j job, dst string) (conflictDecision, string, error) {
+	switch policy {
+	case ConflictSkip:
+		return decideSkip, dst, nil
+	case ConflictOverwrite:
+		return decideOverwrite, dst, nil
+	case ConflictKeepNewer, ConflictKeepLarger:
+		existing, err := fsys.Stat(dst)
+		if err != nil {
+			return 0, dst, err
+		}
+		if policy == ConflictKeepNewer && j.info.ModTime().After(existing.ModTime()) ||
+			policy == ConflictKeepLarger && j.info.Size() > existing.Size() {
+			return decideOverwrite, dst, nil
+		}
+		return decideSkip, dst, nil
+	case ConflictHashCompare:
+		same, err := sameContent(fsys, j.srcPath, dst)
+		if err != nil {
+			return 0, dst, err
+		}
+		if same {
+			return decideDuplicate, dst, nil
+		}
+	}
+	next, err := nextAvailableName(fsys, dst)
+	return decideRename, next, err
+}
+
+// backupPathFor picks where an overwritten target is kept so undo can put
+// it back: <manifests>/backups/<run>/<path relative to dstRoot>.
+func backupPathFor(cfg *config, dst string) (string, error) {
+	run, err := cfg.journal.reserve()
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", errJournal, err)
+	}
+	rel, err := filepath.Rel(cfg.dstRoot, dst)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		rel = filepath.Base(dst)
+	}
+	p := filepath.Join(cfg.dstRoot, manifestDirName, backupsDirName, journalName(run), rel)
+	if exists(OS, p) {
+		return nextAvailableName(OS, p)
+	}
+	return p, nil
+}
+
+// overwriteFile moves the current target to backup and places src there
+// according to mode. If placing fails the backup is put back.
+func overwriteFile(mover Mover, src, dst, backup string) error {
+	if err := os.MkdirAll(filepath.Dir(backup), 0o755); err != nil {
+		return err
+	}
+	if err := os.Rename(dst, backup); err != nil {
+		return fmt.Errorf("backup %s: %w", dst, err)
+	}
+	if err := mover.Place(src, dst); err != nil {
+		_ = os.Remove(dst)
+		if rerr := os.Rename(backup, dst); rerr != nil {
+			return fmt.Errorf("%v (and restoring backup failed: %v)", err, rerr)
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,349 @@
+package organizer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Dedupe policies (WithDedupe, --dedupe).
+const (
+	DedupeSkip         = "skip"          // leave the duplicate where it is
+	DedupeDeleteSource = "delete-source" // remove the duplicate
+	DedupeHardlink     = "hardlink"      // replace the duplicate with a hard link to the kept copy
+	DedupeMoveTo       = "move-to"       // move the duplicate under dstRoot/Duplicates/
+)
+
+// duplicatesDir is where the move-to policy puts duplicates.
+const duplicatesDir = "Duplicates"
+
+// Manifest actions recorded for duplicates. A plain move has an empty action.
+const (
+	actionSkipDuplicate   = "skip-duplicate"
+	actionDeleteDuplicate = "delete-duplicate"
+	actionHardlink        = "hardlink-duplicate"
+	actionMoveDuplicate   = "move-duplicate"
+)
+
+// IsDuplicateAction reports whether an Event action is one of the
+// duplicate actions.
+func IsDuplicateAction(a string) bool {
+	switch a {
+	case actionSkipDuplicate, actionDeleteDuplicate, actionHardlink, actionMoveDuplicate:
+		return true
+	}
+	return false
+}
+
+// dedupePolicyFor maps a recorded duplicate action back to its policy.
+func dedupePolicyFor(action string) string {
+	switch action {
+	case actionDeleteDuplicate:
+		return DedupeDeleteSource
+	case actionHardlink:
+		return DedupeHardlink
+	case actionMoveDuplicate:
+		return DedupeMoveTo
+	}
+	return DedupeSkip
+}
+
+func validDedupePolicy(p string) bool {
+	switch p {
+	case "", DedupeSkip, DedupeDeleteSource, DedupeHardlink, DedupeMoveTo:
+		return true
+	}
+	return false
+}
+
+// dedupeEntry is a known file; its hash is computed lazily because most
+// files never share a size with anything else.
+type dedupeEntry struct {
+	path   string
+	hash   string
+	placed chan struct{} // closed once path is where the file stays
+	once   sync.Once
+}
+
+// settled is the placed channel of entries already in place, like the
+// files found in dstRoot.
+var settled = func() chan struct{} {
+	c := make(chan struct{})
+	close(c)
+	return c
+}()
+
+// settle publishes where a newly registered file ended up (its source
+// path if it was not moved). Only the first call counts.
+func (e *dedupeEntry) settle(path string) {
+	e.once.Do(func() {
+		e.path = path
+		close(e.placed)
+	})
+}
+
+// keptPath waits until the entry's file is in place and returns where.
+// A duplicate found while the original is still being moved thus never
+// records the path it is leaving.
+func (e *dedupeEntry) keptPath() string {
+	<-e.placed
+	return e.path
+}
+
+// dedupeBucket holds the known files of one size. Its lock is held while
+// they are hashed, so only files of the same size wait on each other.
+type dedupeBucket struct {
+	mu      sync.Mutex
+	entries []*dedupeEntry
+}
+
+// dedupeIndex finds content duplicates across the current batch and the
+// files already organized under dstRoot. Files are grouped by size first
+// and only hashed (SHA-256) when another file has the same size.
+type dedupeIndex struct {
+	fs     FS
+	mu     sync.Mutex // guards bySize, not the buckets
+	bySize map[int64]*dedupeBucket
+}
+
+// newDedupeIndex seeds the index with every file already organized in dst.
+func newDedupeIndex(cfg *config) *dedupeIndex {
+	idx := &dedupeIndex{fs: cfg.fs, bySize: make(map[int64]*dedupeBucket)}
+	_ = cfg.fs.Walk(cfg.dstRoot, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info.IsDir() {
+			if ownDir(info.Name()) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.Mode().IsRegular() && inCategorizedSubfolder(cfg, path) {
+			b := idx.bucket(info.Size())
+			b.entries = append(b.entries, &dedupeEntry{path: path, placed: settled})
+		}
+		return nil
+	})
+	return idx
+}
+
+func (idx *dedupeIndex) bucket(size int64) *dedupeBucket {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	b, ok := idx.bySize[size]
+	if !ok {
+		b = new(dedupeBucket)
+		idx.bySize[size] = b
+	}
+	return b
+}
+
+// claim returns the kept copy that path duplicates or, if there is none,
+// registers path as a new original and returns its entry with isNew set;
+// the caller must then settle it. Checking and registering happen under
+// the size's lock so two identical files in the same batch can't both win.
+func (idx *dedupeIndex) claim(path string, size int64) (e *dedupeEntry, isNew bool, err error) {
+	b := idx.bucket(size)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	self := &dedupeEntry{path: path, placed: make(chan struct{})}
+	if len(b.entries) > 0 {
+		if self.hash, err = hashFile(idx.fs, path); err != nil {
+			return nil, false, err
+		}
+		for _, c := range b.entries {
+			if c.hash == "" {
+				// A file still being placed is hashed where it ends up
+				if c.hash, err = hashFile(idx.fs, c.keptPath()); err != nil {
+					continue // vanished or unreadable; can't be a match
+				}
+			}
+			if c.hash == self.hash {
+				return c, false, nil
+			}
+		}
+	}
+	b.entries = append(b.entries, self)
+	return self, true, nil
+}
+
+func hashFile(fsys FS, path string) (string, error) {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// handleDuplicate applies a dedupe policy to src, a duplicate of kept.
+func handleDuplicate(j job, kept, policy string, cfg *config) result {
+	r := result{srcPath: j.srcPath, dstPath: kept, dupOf: kept}
+	switch policy {
+	case DedupeSkip:
+		r.action = actionSkipDuplicate
+		if !cfg.dryRun {
+			r.err = cfg.apply(Move{Src: j.srcPath, Dst: kept, Action: r.action}, func() error { return nil })
+		}
+		return r
+
+	case DedupeDeleteSource:
+		r.action = actionDeleteDuplicate
+		m := Move{Src: j.srcPath, Dst: kept, Action: r.action}
+		if r.err = fingerprintKept(&m, j, cfg); r.err != nil {
+			return r
+		}
+		if len(j.sidecars) > 0 {
+			m.Group, r.group = j.srcPath, j.srcPath
+			defer cfg.lockDir(filepath.Dir(kept))()
+		}
+		r.err = cfg.apply(m, func() error {
+			return cfg.fs.Remove(j.srcPath)
+		})
+		if r.err == nil {
+			// Its sidecars would be orphaned: they join the kept copy
+			r.sidecars = duplicateSidecars(j, kept, cfg)
+		}
+		return r
+
+	case DedupeHardlink:
+		r.action = actionHardlink
+		if !cfg.dryRun {
+			m := Move{Src: j.srcPath, Dst: kept, Action: r.action}
+			if r.err = fingerprintKept(&m, j, cfg); r.err != nil {
+				return r
+			}
+			r.err = cfg.apply(m, func() error {
+				return replaceWithLink(j.srcPath, kept)
+			})
+		}
+		return r
+
+	case DedupeMoveTo:
+		r.action = actionMoveDuplicate
+		dstPath := filepath.Join(cfg.dstRoot, duplicatesDir, j.info.Name())
+		if j.plan != nil {
+			dstPath = j.plan.Dst
+		}
+		r.dstPath = dstPath
+		defer cfg.lockDir(filepath.Dir(dstPath))()
+		if err := cfg.fs.MkdirAll(filepath.Dir(dstPath), 0o755); err != nil {
+			r.err = err
+			return r
+		}
+		if exists(cfg.fs, dstPath) {
+			r.renamed = dstPath
+			if dstPath, r.err = nextAvailableName(cfg.fs, dstPath); r.err != nil {
+				return r
+			}
+			r.dstPath = dstPath
+		}
+		m := Move{Src: j.srcPath, Dst: dstPath, Action: r.action}
+		if len(j.sidecars) > 0 {
+			m.Group, r.group = j.srcPath, j.srcPath
+		}
+		r.err = cfg.apply(m, func() error {
+			return moveFile(cfg.fs, j.srcPath, dstPath)
+		})
+		if r.err == nil {
+			r.sidecars = duplicateSidecars(j, dstPath, cfg)
+		}
+		return r
+	}
+	r.err = fmt.Errorf("unknown dedupe policy %q", policy)
+	return r
+}
+
+// fingerprintKept records the content of a duplicate that is about to be
+// deleted or replaced by a link. Undo recreates it from the kept copy,
+// m.Dst, so it must know whether that copy was edited since.
+func fingerprintKept(m *Move, j job, cfg *config) error {
+	if cfg.journal == nil {
+		return nil
+	}
+	sum, err := hashFile(cfg.fs, j.srcPath)
+	if err != nil {
+		return err
+	}
+	m.Size, m.Hash = j.info.Size(), sum
+	return nil
+}
+
+// duplicateSidecars moves the sidecars of a duplicate that was deleted or
+// moved aside next to dst, the kept copy or where the duplicate went, so
+// they stay paired with a file. One that matches a sidecar already there
+// is deleted as a duplicate itself. The caller holds dst's folder lock.
+func duplicateSidecars(j job, dst string, cfg *config) []result {
+	var out []result
+	for _, s := range j.sidecars {
+		target := sidecarDst(j, s, dst)
+		r := result{srcPath: s.srcPath, dstPath: target, action: "move", note: "sidecar of " + filepath.Base(j.srcPath),
+			bytes: s.info.Size(), group: j.srcPath, info: s.info}
+		start := time.Now()
+		m := Move{Src: s.srcPath, Dst: target, Group: j.srcPath}
+		err := fingerprintKept(&m, s, cfg)
+		if err == nil && exists(cfg.fs, target) {
+			var same bool
+			if same, err = sameContent(cfg.fs, s.srcPath, target); err == nil && same {
+				r.action, r.dupOf, r.note = actionDeleteDuplicate, target, "duplicate sidecar of "+filepath.Base(j.srcPath)
+				m.Action = actionDeleteDuplicate
+			} else if err == nil {
+				r.renamed = target
+				if target, err = nextAvailableName(cfg.fs, target); err == nil {
+					r.dstPath, m.Dst = target, target
+				}
+			}
+		}
+		if err == nil {
+			err = cfg.apply(m, func() error {
+				if m.Action == actionDeleteDuplicate {
+					return cfg.fs.Remove(s.srcPath)
+				}
+				return moveFile(cfg.fs, s.srcPath, target)
+			})
+		}
+		if err != nil {
+			r.err, r.action = err, ""
+		}
+		r.elapsed = time.Since(start)
+		out = append(out, r)
+	}
+	return out
+}
+
+// replaceWithLink swaps path for a hard link to target via a temporary
+// name, so path is never missing if linking fails.
+func replaceWithLink(path, target string) error {
+	tmp := path + ".organizer-link"
+	if err := os.Link(target, tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// restoreCopy recreates path as an independent copy of from. Undo uses it
+// for deleted and hard-linked duplicates.
+func restoreCopy(from, path string) error {
+	tmp := path + ".organizer-restore"
+	if err := copyFile(from, tmp); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
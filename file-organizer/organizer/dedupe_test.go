@@ -0,0 +1,97 @@
+package organizer
+
+import (
+	"io"
+	"maps"
+	"path/filepath"
+	"testing"
+)
+
+func TestDuplicateSidecars(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy string
+		kept   map[string]string // extra files next to the kept copy
+		want   map[string]string
+	}{
+		{
+			name:   "deleted: sidecars join the kept copy",
+			policy: DedupeDeleteSource,
+			want:   map[string]string{"dst/Images/b.jpg": "same", "dst/Images/b.xmp": "edits", "dst/Images/b.aae": "adj"},
+		},
+		{
+			name:   "deleted: a sidecar the kept copy already has is deleted too",
+			policy: DedupeDeleteSource,
+			kept:   map[string]string{"dst/Images/b.xmp": "edits"},
+			want:   map[string]string{"dst/Images/b.jpg": "same", "dst/Images/b.xmp": "edits", "dst/Images/b.aae": "adj"},
+		},
+		{
+			name:   "deleted: a different sidecar is kept under a free name",
+			policy: DedupeDeleteSource,
+			kept:   map[string]string{"dst/Images/b.xmp": "other edits"},
+			want:   map[string]string{"dst/Images/b.jpg": "same", "dst/Images/b.xmp": "other edits", "dst/Images/b (1).xmp": "edits", "dst/Images/b.aae": "adj"},
+		},
+		{
+			name:   "moved aside: sidecars follow",
+			policy: DedupeMoveTo,
+			want:   map[string]string{"dst/Images/b.jpg": "same", "dst/Duplicates/a.jpg": "same", "dst/Duplicates/a.xmp": "edits", "dst/Duplicates/a.aae": "adj"},
+		},
+		{
+			name:   "skipped: sidecars stay with it",
+			policy: DedupeSkip,
+			want:   map[string]string{"dst/Images/b.jpg": "same", "src/a.jpg": "same", "src/a.xmp": "edits", "src/a.aae": "adj"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := map[string]string{"src/a.jpg": "same", "src/a.xmp": "edits", "src/a.aae": "adj", "dst/Images/b.jpg": "same"}
+			maps.Copy(files, tt.kept)
+			m := memTree(t, files)
+			sum := runMem(t, m, WithDedupe(tt.policy))
+			if sum.Failed > 0 {
+				t.Fatalf("%d file(s) failed", sum.Failed)
+			}
+			if got := memFiles(t, m); !maps.Equal(got, tt.want) {
+				t.Errorf("got  %v\nwant %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDuplicateSidecarsPlanned(t *testing.T) {
+	files := map[string]string{"src/a.jpg": "same", "src/a.xmp": "edits", "dst/Images/b.jpg": "same"}
+	m := memTree(t, files)
+	sum := runMem(t, m, WithDryRun(true), WithDedupe(DedupeDeleteSource))
+	if got := memFiles(t, m); !maps.Equal(got, files) {
+		t.Fatalf("dry run changed the tree: %v", got)
+	}
+	applied := runMem(t, m, WithPlan(sum.Plan))
+	if applied.Failed > 0 {
+		t.Fatalf("%d file(s) failed", applied.Failed)
+	}
+	want := map[string]string{"dst/Images/b.jpg": "same", "dst/Images/b.xmp": "edits"}
+	if got := memFiles(t, m); !maps.Equal(got, want) {
+		t.Errorf("got  %v\nwant %v", got, want)
+	}
+}
+
+func TestUndoDuplicateSidecars(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	writeTree(t, src, map[string]string{"a.jpg": "same", "a.xmp": "edits"})
+	writeTree(t, dst, map[string]string{"Images/b.jpg": "same"})
+	sum := organize(t, src, dst, WithDedupe(DedupeDeleteSource))
+	if sum.Duplicates != 1 || !exists(OS, filepath.Join(dst, "Images", "b.xmp")) {
+		t.Fatalf("duplicates = %d; want 1 with its sidecar next to the kept copy", sum.Duplicates)
+	}
+	if err := Undo(sum.Manifest, UndoOptions{Out: io.Discard}); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a.jpg", "a.xmp"} {
+		if !exists(OS, filepath.Join(src, name)) {
+			t.Errorf("%s not restored", name)
+		}
+	}
+	if exists(OS, filepath.Join(dst, "Images", "b.xmp")) {
+		t.Error("the moved sidecar is still next to the kept copy")
+	}
+}
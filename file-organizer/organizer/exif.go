@@ -0,0 +1,293 @@
+package organizer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// exifData is the subset of EXIF we use for organizing photos.
+type exifData struct {
+	Taken       time.Time // DateTimeOriginal, falling back to DateTimeDigitized/DateTime
+	Make        string
+	Model       string
+	Orientation int // 1-8, 0 if absent
+}
+
+// heicScanLen bounds the search for the Exif item inside HEIC files.
+const heicScanLen = 4 << 20
+
+// TIFF/EXIF tags we read.
+const (
+	tagMake              = 0x010F
+	tagModel             = 0x0110
+	tagOrientation       = 0x0112
+	tagDateTime          = 0x0132
+	tagExifIFD           = 0x8769
+	tagDateTimeOriginal  = 0x9003
+	tagDateTimeDigitized = 0x9004
+)
+
+var errNoExif = errors.New("no exif data")
+
+// exifExts are the formats readExif understands.
+var exifExts = map[string]bool{
+	".jpg": true, ".jpeg": true, ".jpe": true, ".jfif": true,
+	".heic": true, ".heif": true,
+	".tif": true, ".tiff": true, ".dng": true, ".cr2": true, ".nef": true, ".arw": true,
+}
+
+// readExif extracts EXIF metadata from a JPEG, HEIC or TIFF-based file.
+func readExif(fsys FS, path string) (*exifData, error) {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var magic [4]byte
+	if _, err := io.ReadFull(f, magic[:]); err != nil {
+		return nil, errNoExif
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case magic[0] == 0xFF && magic[1] == 0xD8:
+		return jpegExif(f)
+	case string(magic[:]) == "II*\x00" || string(magic[:]) == "MM\x00*":
+		b, err := io.ReadAll(io.LimitReader(f, heicScanLen))
+		if err != nil {
+			return nil, err
+		}
+		return parseTIFF(b)
+	default:
+		if strings.EqualFold(filepath.Ext(path), ".heic") || strings.EqualFold(filepath.Ext(path), ".heif") {
+			return heicExif(f)
+		}
+	}
+	return nil, errNoExif
+}
+
+// jpegExif walks the JPEG marker segments up to the image data looking for
+// the APP1 "Exif" segment.
+func jpegExif(r io.Reader) (*exifData, error) {
+	br := bufio.NewReader(r)
+	var soi [2]byte
+	if _, err := io.ReadFull(br, soi[:]); err != nil {
+		return nil, errNoExif
+	}
+	for {
+		var hdr [4]byte
+		if _, err := io.ReadFull(br, hdr[:]); err != nil || hdr[0] != 0xFF {
+			return nil, errNoExif
+		}
+		marker := hdr[1]
+		if marker == 0xDA || marker == 0xD9 { // start of scan / end of image
+			return nil, errNoExif
+		}
+		n := int(binary.BigEndian.Uint16(hdr[2:4])) - 2
+		if n < 0 {
+			return nil, errNoExif
+		}
+		if marker != 0xE1 {
+			if _, err := br.Discard(n); err != nil {
+				return nil, errNoExif
+			}
+			continue
+		}
+		seg := make([]byte, n)
+		if _, err := io.ReadFull(br, seg); err != nil {
+			return nil, errNoExif
+		}
+		if bytes.HasPrefix(seg, []byte("Exif\x00\x00")) {
+			return parseTIFF(seg[6:])
+		}
+	}
+}
+
+// heicExif finds the Exif item payload by its "Exif\0\0" + TIFF header
+// signature rather than fully parsing the ISO BMFF item tables; camera
+// HEICs store it near the front of the file.
+func heicExif(r io.Reader) (*exifData, error) {
+	b, err := io.ReadAll(io.LimitReader(r, heicScanLen))
+	if err != nil {
+		return nil, err
+	}
+	for _, sig := range []string{"Exif\x00\x00II*\x00", "Exif\x00\x00MM\x00*"} {
+		if i := bytes.Index(b, []byte(sig)); i >= 0 {
+			return parseTIFF(b[i+6:])
+		}
+	}
+	return nil, errNoExif
+}
+
+// parseTIFF reads IFD0 and the EXIF sub-IFD of a TIFF structure.
+func parseTIFF(b []byte) (*exifData, error) {
+	if len(b) < 8 {
+		return nil, errNoExif
+	}
+	var bo binary.ByteOrder
+	switch string(b[:2]) {
+	case "II":
+		bo = binary.LittleEndian
+	case "MM":
+		bo = binary.BigEndian
+	default:
+		return nil, errNoExif
+	}
+	if bo.Uint16(b[2:4]) != 42 {
+		return nil, errNoExif
+	}
+
+	t := tiffReader{b: b, bo: bo}
+	ifd0 := t.readIFD(bo.Uint32(b[4:8]))
+	if ifd0 == nil {
+		return nil, errNoExif
+	}
+
+	x := &exifData{
+		Make:        t.ascii(ifd0[tagMake]),
+		Model:       t.ascii(ifd0[tagModel]),
+		Orientation: t.short(ifd0[tagOrientation]),
+	}
+	dates := []string{t.ascii(ifd0[tagDateTime])}
+	if e, ok := ifd0[tagExifIFD]; ok {
+		if sub := t.readIFD(bo.Uint32(e.value[:])); sub != nil {
+			dates = append([]string{t.ascii(sub[tagDateTimeOriginal]), t.ascii(sub[tagDateTimeDigitized])}, dates...)
+		}
+	}
+	for _, d := range dates {
+		if tm, err := time.ParseInLocation("2006:01:02 15:04:05", d, time.Local); err == nil {
+			x.Taken = tm
+			break
+		}
+	}
+	return x, nil
+}
+
+type ifdEntry struct {
+	typ   uint16
+	count uint32
+	value [4]byte // inline value or offset
+}
+
+type tiffReader struct {
+	b  []byte
+	bo binary.ByteOrder
+}
+
+func (t tiffReader) readIFD(off uint32) map[uint16]ifdEntry {
+	if int(off)+2 > len(t.b) || off == 0 {
+		return nil
+	}
+	n := int(t.bo.Uint16(t.b[off:]))
+	entries := make(map[uint16]ifdEntry, n)
+	for i := 0; i < n; i++ {
+		p := int(off) + 2 + i*12
+		if p+12 > len(t.b) {
+			break
+		}
+		var e ifdEntry
+		e.typ = t.bo.Uint16(t.b[p+2:])
+		e.count = t.bo.Uint32(t.b[p+4:])
+		copy(e.value[:], t.b[p+8:p+12])
+		entries[t.bo.Uint16(t.b[p:])] = e
+	}
+	return entries
+}
+
+// ascii decodes a type-2 (ASCII) entry.
+func (t tiffReader) ascii(e ifdEntry) string {
+	if e.typ != 2 || e.count == 0 {
+		return ""
+	}
+	var raw []byte
+	if e.count <= 4 {
+		raw = e.value[:e.count]
+	} else {
+		off := t.bo.Uint32(e.value[:])
+		if uint64(off)+uint64(e.count) > uint64(len(t.b)) {
+			return ""
+		}
+		raw = t.b[off : off+e.count]
+	}
+	if i := bytes.IndexByte(raw, 0); i >= 0 {
+		raw = raw[:i]
+	}
+	return strings.TrimSpace(string(raw))
+}
+
+// short decodes a type-3 (SHORT) entry with a single value.
+func (t tiffReader) short(e ifdEntry) int {
+	if e.typ != 3 || e.count == 0 {
+		return 0
+	}
+	return int(t.bo.Uint16(e.value[:2]))
+}
+
+// camera returns a display name such as "Canon EOS R5", dropping the make
+// when the model already starts with it.
+func (x *exifData) camera() string {
+	switch {
+	case x.Model == "":
+		return x.Make
+	case x.Make == "" || strings.HasPrefix(strings.ToLower(x.Model), strings.ToLower(x.Make)):
+		return x.Model
+	}
+	return x.Make + " " + x.Model
+}
+
+// exifName cleans a Make or Model string for use as a folder name. The
+// strings come straight from the file, so NULs, control characters and
+// invalid UTF-8 are dropped, and trailing spaces and dots are trimmed,
+// which also turns "." and ".." into "".
+func exifName(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if r == utf8.RuneError || unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, s)
+	return strings.TrimRight(strings.TrimSpace(s), " .")
+}
+
+// exifLayoutVars fills the {exif.*} and {camera} layout variables. Missing
+// values render as "Unknown" so undated photos still land somewhere sane.
+func exifLayoutVars(vars map[string]string, x *exifData) {
+	const unknown = "Unknown"
+	for _, k := range []string{"exif.year", "exif.month", "exif.day", "exif.date", "exif.make", "exif.model", "exif.orientation", "camera"} {
+		vars[k] = unknown
+	}
+	if x == nil {
+		return
+	}
+	if !x.Taken.IsZero() {
+		vars["exif.year"] = x.Taken.Format("2006")
+		vars["exif.month"] = x.Taken.Format("01")
+		vars["exif.day"] = x.Taken.Format("02")
+		vars["exif.date"] = x.Taken.Format("2006-01-02")
+	}
+	names := exifData{Make: exifName(x.Make), Model: exifName(x.Model)}
+	if names.Make != "" {
+		vars["exif.make"] = names.Make
+	}
+	if names.Model != "" {
+		vars["exif.model"] = names.Model
+	}
+	if x.Orientation != 0 {
+		vars["exif.orientation"] = strconv.Itoa(x.Orientation)
+	}
+	if c := names.camera(); c != "" {
+		vars["camera"] = c
+	}
+}
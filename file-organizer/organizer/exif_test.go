@@ -0,0 +1,85 @@
+package organizer
+
+import (
+	"encoding/binary"
+	"path/filepath"
+	"testing"
+)
+
+// tiffWith builds a little-endian TIFF whose IFD0 holds the given ASCII
+// Make and Model values byte for byte, so they can carry anything a
+// crafted file might.
+func tiffWith(mk, model string) []byte {
+	le := binary.LittleEndian
+	b := []byte("II*\x00\x08\x00\x00\x00")
+	b = le.AppendUint16(b, 2)
+	data := 8 + 2 + 2*12 + 4
+	var tail []byte
+	for _, e := range []struct {
+		tag uint16
+		s   string
+	}{{tagMake, mk}, {tagModel, model}} {
+		b = le.AppendUint16(b, e.tag)
+		b = le.AppendUint16(b, 2)
+		b = le.AppendUint32(b, uint32(len(e.s)))
+		if len(e.s) <= 4 {
+			var v [4]byte
+			copy(v[:], e.s)
+			b = append(b, v[:]...)
+			continue
+		}
+		b = le.AppendUint32(b, uint32(data+len(tail)))
+		tail = append(tail, e.s...)
+	}
+	b = le.AppendUint32(b, 0)
+	return append(b, tail...)
+}
+
+func TestExifMakeModel(t *testing.T) {
+	tests := []struct {
+		name                string
+		mk, model           string
+		wantMake, wantModel string
+		wantCamera          string
+	}{
+		{"plain", "Canon\x00", "Canon EOS R5\x00", "Canon", "Canon EOS R5", "Canon EOS R5"},
+		{"padded", "NIKON CORPORATION   \x00", "NIKON D750 \x00", "NIKON CORPORATION", "NIKON D750", "NIKON CORPORATION NIKON D750"},
+		{"garbage after the NUL", "Sony\x00../../x", "ILCE-7M3\x00", "Sony", "ILCE-7M3", "Sony ILCE-7M3"},
+		{"control characters", "Ev\x01il\x1b[31m\x00", "Cam\ttab\x7f\x00", "Evil[31m", "Camtab", "Evil[31m Camtab"},
+		{"invalid UTF-8", "Br\xffand\x00", "M\xc3odel\x00", "Brand", "Model", "Brand Model"},
+		{"trailing dots", "Acme Inc.\x00", "X100...\x00", "Acme Inc", "X100", "Acme Inc X100"},
+		{"dot segments", "..\x00", ".\x00", "Unknown", "Unknown", "Unknown"},
+		{"dots and spaces", ". . .\x00", " .. \x00", "Unknown", "Unknown", "Unknown"},
+		{"blank", "   \x00", "\x00", "Unknown", "Unknown", "Unknown"},
+		{"only control characters", "\x01\x02\x03\x04\x05\x00", "\r\n\x00", "Unknown", "Unknown", "Unknown"},
+		{"model only", "\x00", "iPhone 15\x00", "Unknown", "iPhone 15", "iPhone 15"},
+	}
+	l, err := parseLayout("{category}/{exif.make}/{exif.model}/{camera}/{name}{ext}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		x, err := parseTIFF(tiffWith(tt.mk, tt.model))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		vars := map[string]string{"category": "Images", "name": "a", "ext": ".jpg"}
+		exifLayoutVars(vars, x)
+		if vars["exif.make"] != tt.wantMake || vars["exif.model"] != tt.wantModel || vars["camera"] != tt.wantCamera {
+			t.Errorf("%s: got make %q, model %q, camera %q; want %q, %q, %q",
+				tt.name, vars["exif.make"], vars["exif.model"], vars["camera"], tt.wantMake, tt.wantModel, tt.wantCamera)
+		}
+		rel, err := l.render(vars)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !filepath.IsLocal(rel) || !l.matchesDir(rel, DefaultRules()) {
+			t.Errorf("%s: rendered %q, which the layout doesn't recognise", tt.name, rel)
+		}
+	}
+
+	if x, err := parseTIFF(tiffWith("Fuji", "X-T5")); err != nil || x.Make != "Fuji" || x.Model != "X-T5" {
+		t.Errorf("inline values: got %+v, %v", x, err)
+	}
+}
@@ -0,0 +1,501 @@
+package organizer
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Event actions for WithExtract. An extraction's Src is the archive and
+// Dst the folder it was unpacked into; a trashed original's Dst is where
+// it is in the trash.
+const (
+	ActionExtract = "extract"
+	ActionTrash   = "trash"
+)
+
+// Journal actions: undo removes an extracted folder (if unchanged) and
+// moves a trashed original back.
+const (
+	actionExtract = ActionExtract
+	actionTrash   = ActionTrash
+)
+
+// What WithExtract does with an archive once it is unpacked.
+const (
+	ExtractKeep  = "keep"
+	ExtractTrash = "trash" // to the trash under the destination root
+)
+
+// Default extraction limits; see WithExtractLimits.
+const (
+	DefaultExtractMaxBytes = 8 << 30
+	DefaultExtractMaxFiles = 100_000
+
+	// extractMaxRatio bounds how much larger than the archive its
+	// contents may be, which real archives stay far below and
+	// compression bombs far above. Archives under extractMinBudget
+	// may always unpack to that much.
+	extractMaxRatio  = 1000
+	extractMinBudget = 1 << 20
+)
+
+// archivesCategory is the only category whose files WithExtract unpacks.
+const archivesCategory = "Archives"
+
+// extractPartialSuffix names the hidden folder an archive is unpacked
+// into before it is put in place: ".<name>" + suffix beside the target.
+const extractPartialSuffix = ".organizer-partial"
+
+var (
+	// errUnsafeArchive marks archives that were not unpacked because of
+	// an entry outside their folder or contents beyond the limits.
+	errUnsafeArchive = errors.New("unsafe archive")
+	errBadArchive    = errors.New("unreadable archive")
+)
+
+// extractConfig is the WithExtract and WithExtractLimits settings.
+type extractConfig struct {
+	originals  string // ExtractKeep or ExtractTrash; "" = extraction off
+	reclassify bool   // organize what was unpacked like any other file
+	maxBytes   int64
+	maxFiles   int
+}
+
+// WithExtract unpacks .zip, .tar, .tar.gz/.tgz and .gz files placed in
+// the Archives category, into a folder named after the archive beside it
+// (with the default layout, Archives/<name>/). originals is ExtractKeep
+// or ExtractTrash; with reclassify the unpacked files are organized in
+// turn (archives among them are not unpacked again). Entries that would
+// land outside the folder, links and archives beyond the limits are
+// refused.
+func WithExtract(originals string, reclassify bool) Option {
+	return func(o *Organizer) error {
+		if originals != ExtractKeep && originals != ExtractTrash {
+			return fmt.Errorf("invalid policy for extracted archives %q (want keep or trash)", originals)
+		}
+		o.extract.originals, o.extract.reclassify = originals, reclassify
+		return nil
+	}
+}
+
+// WithExtractLimits refuses to unpack archives whose contents exceed
+// maxBytes in total or maxFiles entries (0 keeps the default). Contents
+// more than 1000 times larger than the archive are always refused.
+func WithExtractLimits(maxBytes int64, maxFiles int) Option {
+	return func(o *Organizer) error {
+		if maxBytes < 0 || maxFiles < 0 {
+			return fmt.Errorf("invalid extraction limits %d bytes, %d files", maxBytes, maxFiles)
+		}
+		if maxBytes > 0 {
+			o.extract.maxBytes = maxBytes
+		}
+		if maxFiles > 0 {
+			o.extract.maxFiles = maxFiles
+		}
+		return nil
+	}
+}
+
+// archiveKind recognizes the archive formats WithExtract unpacks by
+// name, returning the folder name for the contents and the format.
+func archiveKind(name string) (base, kind string) {
+	lower := strings.ToLower(name)
+	for _, k := range []string{".tar.gz", ".tgz", ".zip", ".tar", ".gz"} {
+		if strings.HasSuffix(lower, k) && len(name) > len(k) {
+			return name[:len(name)-len(k)], k
+		}
+	}
+	return "", ""
+}
+
+// extractPlaced unpacks the archive just placed at path, then organizes
+// its contents and trashes it as configured. It returns a result for
+// each change, starting with the extraction; nothing if path is not an
+// archive or was placed in another category than Archives.
+func extractPlaced(cfg *config, path, category string) []result {
+	base, kind := archiveKind(filepath.Base(path))
+	if kind == "" || category != archivesCategory {
+		return nil
+	}
+	start := time.Now()
+	r := result{srcPath: path, action: ActionExtract, category: category}
+	parent := filepath.Dir(path)
+	dir, partial, err := reserveExtractDir(cfg, filepath.Join(parent, base))
+	r.dstPath = dir
+	if err != nil {
+		r.err, r.elapsed = err, time.Since(start)
+		return []result{r}
+	}
+	if cfg.sim == nil {
+		defer cfg.unpacking.Delete(partial)
+	}
+	fail := func(err error) []result {
+		if cfg.sim == nil {
+			_ = os.RemoveAll(partial)
+		}
+		r.err, r.elapsed = err, time.Since(start)
+		return []result{r}
+	}
+
+	f, err := cfg.fs.Open(path)
+	if err != nil {
+		return fail(err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return fail(err)
+	}
+	u := &unpacker{dst: partial, write: cfg.sim == nil, maxFiles: cfg.extract.maxFiles,
+		budget: min(cfg.extract.maxBytes, max(extractMaxRatio*info.Size(), extractMinBudget))}
+	if err := u.unpack(f, info.Size(), kind, base); err != nil {
+		return fail(err)
+	}
+	r.bytes = u.bytes
+	r.note = fmt.Sprintf("%d file(s)", u.files)
+	if u.skipped > 0 {
+		r.note += fmt.Sprintf(", %d links and special files skipped", u.skipped)
+	}
+	if cfg.sim != nil {
+		r.note += "; contents are not organized in a dry run"
+		r.elapsed = time.Since(start)
+		return append([]result{r}, trashOriginal(cfg, path, category, dir)...)
+	}
+
+	// Put the folder in place; its name may have been taken meanwhile
+	unlock := cfg.lockDir(parent)
+	if exists(cfg.fs, dir) {
+		if dir, err = nextAvailableName(cfg.fs, dir); err != nil {
+			unlock()
+			return fail(err)
+		}
+		r.dstPath = dir
+	}
+	digest, size, err := treeDigest(partial)
+	if err == nil {
+		m := Move{Src: path, Dst: dir, Action: actionExtract, Backup: partial, Category: category, Size: size, Hash: digest}
+		err = cfg.apply(m, func() error {
+			return os.Rename(partial, dir)
+		})
+	}
+	unlock()
+	if err != nil {
+		return fail(err)
+	}
+	r.elapsed = time.Since(start)
+	out := []result{r}
+
+	if cfg.extract.reclassify {
+		out = append(out, reclassifyExtracted(cfg, dir)...)
+	}
+	return append(out, trashOriginal(cfg, path, category, dir)...)
+}
+
+// reserveExtractDir picks a free folder name for an archive's contents
+// and creates the hidden staging folder beside it they are unpacked
+// into. In a dry run the name is taken in the overlay instead, so later
+// archives see it.
+func reserveExtractDir(cfg *config, want string) (dir, partial string, err error) {
+	defer cfg.lockDir(filepath.Dir(want))()
+	staging := func(d string) string {
+		return filepath.Join(filepath.Dir(d), "."+filepath.Base(d)+extractPartialSuffix)
+	}
+	taken := func(d string) bool {
+		if exists(cfg.fs, d) {
+			return true
+		}
+		if cfg.sim != nil {
+			return false
+		}
+		_, busy := cfg.unpacking.Load(staging(d))
+		return busy
+	}
+	dir = want
+	for i := 1; taken(dir); i++ {
+		if i == 10_000 {
+			return want, "", fmt.Errorf("too many name conflicts for %q", want)
+		}
+		dir = fmt.Sprintf("%s (%d)", want, i)
+	}
+	if cfg.sim != nil {
+		return dir, staging(dir), cfg.fs.MkdirAll(dir, 0o755)
+	}
+	partial = staging(dir)
+	// Anything there is left from an extraction that was killed half-way
+	if err := os.RemoveAll(partial); err != nil {
+		return dir, partial, err
+	}
+	if err := os.Mkdir(partial, 0o755); err != nil {
+		return dir, partial, err
+	}
+	cfg.unpacking.Store(partial, true)
+	return dir, partial, nil
+}
+
+// reclassifyExtracted organizes the files unpacked into dir like any
+// other, then removes the folders that leaves empty.
+func reclassifyExtracted(cfg *config, dir string) []result {
+	var jobs []job
+	_ = walkFS(cfg.fs, dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if path != dir && !cfg.includeHidden && isHidden(info) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.Mode().IsRegular() {
+			jobs = append(jobs, job{srcPath: path, info: info, extracted: true})
+		}
+		return nil
+	})
+	out := make([]result, 0, len(jobs))
+	for _, j := range jobs {
+		start := time.Now()
+		r := handleJob(j, cfg)
+		r.elapsed = time.Since(start)
+		if r.bytes == 0 {
+			r.bytes = j.info.Size()
+		}
+		if r.info == nil {
+			r.info = j.info
+		}
+		out = append(out, r)
+	}
+	removeEmptyDirs(dir)
+	return out
+}
+
+// trashOriginal moves an unpacked archive to the trash if so configured.
+func trashOriginal(cfg *config, path, category, dir string) []result {
+	if cfg.extract.originals != ExtractTrash {
+		return nil
+	}
+	return []result{trashFile(cfg, path, actionTrash, category, "extracted to "+dir, time.Now())}
+}
+
+// removeEmptyDirs removes dir and every folder under it that is empty,
+// deepest first.
+func removeEmptyDirs(dir string) {
+	var dirs []string
+	_ = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && info.IsDir() {
+			dirs = append(dirs, path)
+		}
+		return nil
+	})
+	for i := len(dirs) - 1; i >= 0; i-- {
+		_ = os.Remove(dirs[i]) // fails unless empty
+	}
+}
+
+// treeDigest fingerprints a folder by the paths and sizes of its files
+// and links, so undo can tell whether an extracted folder or a copied
+// project changed since. Special files, which copies leave out, don't
+// count.
+func treeDigest(dir string) (digest string, size int64, err error) {
+	var lines []string
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == dir {
+			return nil
+		}
+		rel, _ := filepath.Rel(dir, path)
+		if info.IsDir() {
+			lines = append(lines, filepath.ToSlash(rel)+"/")
+			return nil
+		}
+		if !info.Mode().IsRegular() && info.Mode()&os.ModeSymlink == 0 {
+			return nil
+		}
+		lines = append(lines, fmt.Sprintf("%s\x00%d", filepath.ToSlash(rel), info.Size()))
+		size += info.Size()
+		return nil
+	})
+	if err != nil {
+		return "", 0, err
+	}
+	sort.Strings(lines)
+	h := sha256.New()
+	for _, l := range lines {
+		io.WriteString(h, l+"\n")
+	}
+	return hex.EncodeToString(h.Sum(nil)), size, nil
+}
+
+// unpacker writes (or, in a dry run, only reads) an archive's entries
+// under dst, enforcing the limits on what it actually decompresses
+// rather than on what the headers claim.
+type unpacker struct {
+	dst      string
+	write    bool
+	budget   int64 // bytes the contents may take
+	maxFiles int
+
+	files, skipped int
+	bytes          int64
+}
+
+func (u *unpacker) unpack(f File, size int64, kind, base string) error {
+	switch kind {
+	case ".zip":
+		zr, err := zip.NewReader(f, size)
+		if err != nil {
+			return fmt.Errorf("%w: %w", errBadArchive, err)
+		}
+		return u.unzip(zr)
+	case ".tar":
+		return u.untar(tar.NewReader(f))
+	}
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errBadArchive, err)
+	}
+	defer gz.Close()
+	if kind == ".gz" {
+		return u.file(base, 0o644, gz.ModTime, gz)
+	}
+	return u.untar(tar.NewReader(gz))
+}
+
+func (u *unpacker) unzip(zr *zip.Reader) error {
+	// Refuse early what the headers already give away
+	var declared uint64
+	for _, zf := range zr.File {
+		declared += zf.UncompressedSize64
+	}
+	if declared > uint64(u.budget) {
+		return u.tooLarge()
+	}
+	for _, zf := range zr.File {
+		mode := zf.Mode()
+		switch {
+		case mode.IsDir():
+			if err := u.dir(zf.Name); err != nil {
+				return err
+			}
+			continue
+		case !mode.IsRegular():
+			u.skipped++
+			continue
+		}
+		rc, err := zf.Open()
+		if err != nil {
+			return fmt.Errorf("%w: %s: %w", errBadArchive, zf.Name, err)
+		}
+		err = u.file(zf.Name, mode, zf.Modified, rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (u *unpacker) untar(tr *tar.Reader) error {
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %w", errBadArchive, err)
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = u.dir(hdr.Name)
+		case tar.TypeReg, tar.TypeRegA:
+			err = u.file(hdr.Name, hdr.FileInfo().Mode(), hdr.ModTime, tr)
+		case tar.TypeXGlobalHeader:
+		default:
+			u.skipped++ // links could point anywhere; devices and fifos are no use
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// entryPath turns an entry name into a path under dst, refusing any that
+// would end up elsewhere ("zip slip").
+func (u *unpacker) entryPath(name string) (string, error) {
+	rel := filepath.FromSlash(strings.TrimSuffix(name, "/"))
+	if !filepath.IsLocal(rel) {
+		return "", fmt.Errorf("%w: entry %q points outside the archive's folder", errUnsafeArchive, name)
+	}
+	return filepath.Join(u.dst, rel), nil
+}
+
+func (u *unpacker) dir(name string) error {
+	path, err := u.entryPath(name)
+	if err != nil || !u.write {
+		return err
+	}
+	return os.MkdirAll(path, 0o755)
+}
+
+func (u *unpacker) file(name string, mode fs.FileMode, modTime time.Time, r io.Reader) error {
+	path, err := u.entryPath(name)
+	if err != nil {
+		return err
+	}
+	if u.files++; u.files > u.maxFiles {
+		return fmt.Errorf("%w: more than %d files", errUnsafeArchive, u.maxFiles)
+	}
+	// Read one byte past the budget to tell "exactly fits" from "too big"
+	lr := io.LimitReader(r, u.budget-u.bytes+1)
+	var n int64
+	if !u.write {
+		n, err = io.Copy(io.Discard, lr)
+	} else {
+		n, err = writeEntry(path, mode, lr)
+	}
+	u.bytes += n
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	if u.bytes > u.budget {
+		return u.tooLarge()
+	}
+	if u.write && !modTime.IsZero() {
+		_ = os.Chtimes(path, modTime, modTime)
+	}
+	return nil
+}
+
+func (u *unpacker) tooLarge() error {
+	return fmt.Errorf("%w: contents exceed %d bytes", errUnsafeArchive, u.budget)
+}
+
+// writeEntry creates a new file (never replacing or following anything
+// already there) with the entry's permissions, minus setuid and the like.
+func writeEntry(path string, mode fs.FileMode, r io.Reader) (int64, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return 0, err
+	}
+	out, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode.Perm()|0o600)
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(out, r)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	return n, err
+}
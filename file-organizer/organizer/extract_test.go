@@ -0,0 +1,136 @@
+package organizer
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestExtractEntryPath(t *testing.T) {
+	u := &unpacker{dst: "/dst/Archives/a"}
+	tests := []struct {
+		name string
+		want string // "" = refused
+	}{
+		{"a.txt", "/dst/Archives/a/a.txt"},
+		{"dir/", "/dst/Archives/a/dir"},
+		{"dir/./b.txt", "/dst/Archives/a/dir/b.txt"},
+		{"dir/../b.txt", "/dst/Archives/a/b.txt"},
+		{"../evil.txt", ""},
+		{"dir/../../evil.txt", ""},
+		{"/etc/passwd", ""},
+		{"..", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		got, err := u.entryPath(tt.name)
+		switch {
+		case tt.want == "" && !errors.Is(err, errUnsafeArchive):
+			t.Errorf("%q: got %q, %v; want it refused", tt.name, got, err)
+		case tt.want != "" && (err != nil || got != tt.want):
+			t.Errorf("%q: got %q, %v; want %q", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+// zipOf builds a zip archive of name -> content.
+func zipOf(t *testing.T, entries ...[2]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, e := range entries {
+		w, err := zw.Create(e[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(e[1])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// tgzOf builds a .tar.gz archive from headers and their contents.
+func tgzOf(t *testing.T, entries map[*tar.Header]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for hdr, data := range entries {
+		hdr.Size = int64(len(data))
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestUnpackRefusesUnsafeArchives(t *testing.T) {
+	bomb := strings.Repeat("0", 4<<20)
+	tests := []struct {
+		name    string
+		kind    string
+		archive []byte
+		budget  int64
+		files   int // what a safe archive unpacks to
+		skipped int
+	}{
+		{name: "zip", kind: ".zip", archive: zipOf(t, [2]string{"a.txt", "a"}, [2]string{"dir/b.txt", "b"}), files: 2},
+		{name: "zip slip", kind: ".zip", archive: zipOf(t, [2]string{"ok.txt", "a"}, [2]string{"../../evil.txt", "x"})},
+		{name: "absolute zip entry", kind: ".zip", archive: zipOf(t, [2]string{"/etc/evil", "x"})},
+		{name: "tar slip", kind: ".tar.gz", archive: tgzOf(t, map[*tar.Header]string{
+			{Name: "../evil.txt", Mode: 0o644, Typeflag: tar.TypeReg}: "x",
+		})},
+		{name: "tar links skipped", kind: ".tar.gz", files: 1, skipped: 2, archive: tgzOf(t, map[*tar.Header]string{
+			{Name: "a.txt", Mode: 0o644, Typeflag: tar.TypeReg}:                            "a",
+			{Name: "link", Linkname: "/etc/passwd", Typeflag: tar.TypeSymlink}:             "",
+			{Name: "hard", Linkname: "../../outside", Mode: 0o644, Typeflag: tar.TypeLink}: "",
+		})},
+		{name: "zip bomb", kind: ".zip", budget: 1 << 20, archive: zipOf(t, [2]string{"zeros", bomb})},
+		{name: "tar bomb", kind: ".tar.gz", budget: 1 << 20, archive: tgzOf(t, map[*tar.Header]string{
+			{Name: "zeros", Mode: 0o644, Typeflag: tar.TypeReg}: bomb,
+		})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := memTree(t, map[string]string{"src/a" + tt.kind: string(tt.archive)})
+			f, err := m.Open("/src/a" + tt.kind)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			budget := tt.budget
+			if budget == 0 {
+				budget = DefaultExtractMaxBytes
+			}
+			// Without write, entries are checked and read but not written
+			u := &unpacker{dst: "/dst/a", budget: budget, maxFiles: DefaultExtractMaxFiles}
+			err = u.unpack(f, int64(len(tt.archive)), tt.kind, "a")
+			if tt.files == 0 {
+				if !errors.Is(err, errUnsafeArchive) {
+					t.Errorf("got %v, want %v", err, errUnsafeArchive)
+				}
+				return
+			}
+			if err != nil || u.files != tt.files || u.skipped != tt.skipped {
+				t.Errorf("got %v with %d file(s), %d skipped; want %d, %d", err, u.files, u.skipped, tt.files, tt.skipped)
+			}
+		})
+	}
+}
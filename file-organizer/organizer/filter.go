@@ -0,0 +1,153 @@
+package organizer
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// stateFileName holds per-source bookkeeping such as the last run time.
+const stateFileName = "state.json"
+
+// walkFilter holds the size, age and depth limits applied while walking,
+// before anything is queued.
+type walkFilter struct {
+	root      string
+	maxDepth  int // -1 = unlimited, 0 = only files directly in root
+	minSize   int64
+	maxSize   int64     // 0 = unbounded
+	olderThan time.Time // keep files modified before this; zero = off
+	newerThan time.Time // keep files modified after this; zero = off
+}
+
+// depth counts the directories between root and path: root/a.txt and
+// root/sub are 0, root/sub/a.txt is 1.
+func (f *walkFilter) depth(path string) int {
+	rel, err := filepath.Rel(f.root, path)
+	if err != nil || rel == "." {
+		return 0
+	}
+	return strings.Count(filepath.ToSlash(rel), "/")
+}
+
+// skipDir reports whether the walk should not descend into dir.
+func (f *walkFilter) skipDir(dir string) bool {
+	// A subdirectory at depth d holds files at depth d+1.
+	return f.maxDepth >= 0 && f.depth(dir)+1 > f.maxDepth
+}
+
+// skipFile applies every limit to a file.
+func (f *walkFilter) skipFile(path string, info os.FileInfo) bool {
+	if f.maxDepth >= 0 && f.depth(path) > f.maxDepth {
+		return true
+	}
+	if info.Size() < f.minSize || (f.maxSize > 0 && info.Size() > f.maxSize) {
+		return true
+	}
+	mt := info.ModTime()
+	if !f.olderThan.IsZero() && !mt.Before(f.olderThan) {
+		return true
+	}
+	if !f.newerThan.IsZero() && !mt.After(f.newerThan) {
+		return true
+	}
+	return false
+}
+
+// limitsSizeOrAge reports whether any size or age limit is set.
+func (f *walkFilter) limitsSizeOrAge() bool {
+	return f.minSize > 0 || f.maxSize > 0 || !f.olderThan.IsZero() || !f.newerThan.IsZero()
+}
+
+// ParseAgeCutoff turns an --older-than/--newer-than value into a point in
+// time. It accepts an age (90m, 36h, 30d, 2w) counted back from now, or a
+// date (2024-01-31, 2024-01-31T15:04:05Z07:00).
+func ParseAgeCutoff(s string, now time.Time) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}, nil
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02 15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	d, err := parseAge(s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid age or date %q", s)
+	}
+	return now.Add(-d), nil
+}
+
+// parseAge is time.ParseDuration plus day (d) and week (w) units.
+func parseAge(s string) (time.Duration, error) {
+	if n := len(s); n > 1 && (s[n-1] == 'd' || s[n-1] == 'w') {
+		v, err := strconv.ParseFloat(s[:n-1], 64)
+		if err != nil || v < 0 {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		unit := 24 * time.Hour
+		if s[n-1] == 'w' {
+			unit *= 7
+		}
+		return time.Duration(v * float64(unit)), nil
+	}
+	return time.ParseDuration(s)
+}
+
+// runState is the contents of the state file: when each source directory
+// was last organized.
+type runState struct {
+	LastRun map[string]time.Time `json:"last_run"`
+}
+
+func defaultStatePath(dstRoot string) string {
+	return filepath.Join(dstRoot, manifestDirName, stateFileName)
+}
+
+func loadRunState(path string) (*runState, error) {
+	st := &runState{LastRun: make(map[string]time.Time)}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return st, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, st); err != nil {
+		return nil, fmt.Errorf("state %q: %w", path, err)
+	}
+	if st.LastRun == nil {
+		st.LastRun = make(map[string]time.Time)
+	}
+	return st, nil
+}
+
+// save writes the state atomically.
+func (st *runState) save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// stateKey identifies a source directory in the state file.
+func stateKey(srcDir string) string {
+	abs, err := filepath.Abs(srcDir)
+	if err != nil {
+		return srcDir
+	}
+	return abs
+}
@@ -0,0 +1,108 @@
+package organizer
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// FS is the filesystem an Organizer reads and changes. Paths are
+// OS-style (filepath) paths, as with package os.
+//
+// Besides the OS, there are two implementations: MemFS, an in-memory tree
+// for tests and simulations, and Overlay, which records changes in memory
+// on top of another FS and is what dry runs use.
+type FS interface {
+	Stat(name string) (fs.FileInfo, error)
+	Lstat(name string) (fs.FileInfo, error)
+	Open(name string) (File, error)
+	ReadDir(name string) ([]fs.DirEntry, error) // sorted by name
+	Rename(oldpath, newpath string) error
+	MkdirAll(path string, perm fs.FileMode) error
+	Remove(name string) error
+	Walk(root string, fn filepath.WalkFunc) error
+}
+
+// File is an open file of an FS; metadata readers seek around in it.
+type File interface {
+	fs.File
+	io.ReaderAt
+	io.Seeker
+}
+
+// OS is the FS of the operating system. Only it supports every mode,
+// journaling and watching.
+var OS FS = osFS{}
+
+type osFS struct{}
+
+func (osFS) Stat(name string) (fs.FileInfo, error)        { return os.Stat(name) }
+func (osFS) Lstat(name string) (fs.FileInfo, error)       { return os.Lstat(name) }
+func (osFS) Open(name string) (File, error)               { return os.Open(name) }
+func (osFS) ReadDir(name string) ([]fs.DirEntry, error)   { return os.ReadDir(name) }
+func (osFS) Rename(oldpath, newpath string) error         { return os.Rename(oldpath, newpath) }
+func (osFS) MkdirAll(path string, perm fs.FileMode) error { return os.MkdirAll(path, perm) }
+func (osFS) Remove(name string) error                     { return os.Remove(name) }
+func (osFS) Walk(root string, fn filepath.WalkFunc) error { return filepath.Walk(root, fn) }
+
+// walkFS is filepath.Walk for any FS: lexical order, directories before
+// their contents, symlinks not followed.
+func walkFS(fsys FS, root string, fn filepath.WalkFunc) error {
+	info, err := fsys.Lstat(root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		err = walkFSDir(fsys, root, info, fn)
+	}
+	if errors.Is(err, filepath.SkipDir) || errors.Is(err, filepath.SkipAll) {
+		return nil
+	}
+	return err
+}
+
+func walkFSDir(fsys FS, path string, info fs.FileInfo, fn filepath.WalkFunc) error {
+	if !info.IsDir() {
+		return fn(path, info, nil)
+	}
+	entries, err := fsys.ReadDir(path)
+	err1 := fn(path, info, err)
+	if err != nil || err1 != nil {
+		return err1
+	}
+	names := make([]string, len(entries))
+	for i, e := range entries {
+		names[i] = e.Name()
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		p := filepath.Join(path, name)
+		fi, err := fsys.Lstat(p)
+		if err != nil {
+			if err := fn(p, fi, err); err != nil && !errors.Is(err, filepath.SkipDir) {
+				return err
+			}
+			continue
+		}
+		if err := walkFSDir(fsys, p, fi, fn); err != nil {
+			if !fi.IsDir() || !errors.Is(err, filepath.SkipDir) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func exists(fsys FS, path string) bool {
+	_, err := fsys.Stat(path)
+	return err == nil
+}
+
+// onOS reports whether fsys changes the real filesystem, i.e. whether
+// there is anything to journal.
+func onOS(fsys FS) bool {
+	_, ok := fsys.(osFS)
+	return ok
+}
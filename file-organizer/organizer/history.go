@@ -0,0 +1,178 @@
+package organizer
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Run summarizes one recorded run, i.e. one manifest.
+type Run struct {
+	Manifest   string
+	Started    time.Time
+	Placed     int // files and projects placed (moved, copied or linked)
+	Duplicates int // removed, linked or moved aside; skipped ones changed nothing
+	Trashed    int // moved to the trash: expired, or an archive once extracted
+	Extracted  int // archives unpacked
+	Undone     int
+	InFlight   int // never completed; needs Recover
+}
+
+// Pending is how many changes of the run are still in effect.
+func (r Run) Pending() int {
+	return r.Placed + r.Duplicates + r.Trashed + r.Extracted - r.Undone
+}
+
+// Runs finds every manifest under dstRoot's .organizer-manifests, oldest
+// first.
+func Runs(dstRoot string) ([]Run, error) {
+	dir := filepath.Join(dstRoot, manifestDirName)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var runs []Run
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || name == stateFileName || strings.HasPrefix(name, ".") {
+			continue
+		}
+		var r Run
+		var err error
+		switch filepath.Ext(name) {
+		case ".jsonl":
+			r, err = journalRun(filepath.Join(dir, name))
+		case ".json":
+			r, err = legacyRun(filepath.Join(dir, name))
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if r.Started.IsZero() {
+			if info, err := e.Info(); err == nil {
+				r.Started = info.ModTime()
+			}
+		}
+		runs = append(runs, r)
+	}
+	sort.SliceStable(runs, func(a, b int) bool { return runs[a].Started.Before(runs[b].Started) })
+	return runs, nil
+}
+
+// journalRun counts a JSONL journal's changes by their last outcome.
+func journalRun(path string) (Run, error) {
+	r := Run{Manifest: path}
+	f, err := os.Open(path)
+	if err != nil {
+		return r, err
+	}
+	defer f.Close()
+
+	intents := make(map[int64]journalRecord)
+	outcome := make(map[int64]string)
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64<<10), 16<<20)
+	for sc.Scan() {
+		var rec journalRecord
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			continue
+		}
+		if rec.Op == opIntent {
+			if r.Started.IsZero() {
+				r.Started = rec.When
+			}
+			intents[rec.Seq] = rec
+			continue
+		}
+		outcome[rec.Seq] = rec.Op
+	}
+	if err := sc.Err(); err != nil {
+		return r, err
+	}
+	for seq, rec := range intents {
+		switch outcome[seq] {
+		case "":
+			r.InFlight++
+			continue
+		case opUndone:
+			r.Undone++
+		case opDone:
+		default:
+			continue // failed or rolled back: nothing happened
+		}
+		r.count(rec.Action)
+	}
+	return r, nil
+}
+
+func legacyRun(path string) (Run, error) {
+	r := Run{Manifest: path}
+	moves, err := loadManifest(path, io.Discard)
+	if err != nil {
+		return r, fmt.Errorf("%s: %w", path, err)
+	}
+	for _, m := range moves {
+		if r.Started.IsZero() || m.When.Before(r.Started) {
+			r.Started = m.When
+		}
+		r.count(m.Action)
+	}
+	return r, nil
+}
+
+func (r *Run) count(action string) {
+	switch {
+	case action == actionSkipDuplicate:
+		// Left where it was: nothing to undo, so never pending
+	case IsDuplicateAction(action):
+		r.Duplicates++
+	case action == actionExpire, action == actionTrash:
+		r.Trashed++
+	case action == actionExtract:
+		r.Extracted++
+	default:
+		r.Placed++
+	}
+}
+
+// UndoLast undoes the newest n runs under dstRoot that still have changes
+// in effect, newest first, so later runs are unwound before the earlier
+// ones they built on.
+func UndoLast(dstRoot string, n int, opts UndoOptions) error {
+	opts = opts.withDefaults()
+	runs, err := Runs(dstRoot)
+	if err != nil {
+		return err
+	}
+	var todo []Run
+	for i := len(runs) - 1; i >= 0 && len(todo) < n; i-- {
+		if runs[i].Pending() > 0 {
+			todo = append(todo, runs[i])
+		}
+	}
+	if len(todo) == 0 {
+		fmt.Fprintln(opts.Out, "Nothing to undo.")
+		return nil
+	}
+	for i, r := range todo {
+		if r.InFlight > 0 {
+			return fmt.Errorf("%s has %d change(s) in flight; recover it first", r.Manifest, r.InFlight)
+		}
+		fmt.Fprintf(opts.Out, "== Undoing %s (%d of %d)\n", filepath.Base(r.Manifest), i+1, len(todo))
+		if err := Undo(r.Manifest, opts); err != nil {
+			return fmt.Errorf("%s: %w", r.Manifest, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package organizer
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeTree creates files (relative path -> content) under root.
+func writeTree(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, data := range files {
+		p := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// organize runs an Organizer over src into dst and fails on any error.
+func organize(t *testing.T, src, dst string, opts ...Option) *Summary {
+	t.Helper()
+	o, err := New(src, dst, append([]Option{WithWorkers(2)}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum, err := o.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum.Failed > 0 {
+		t.Fatalf("%d file(s) failed", sum.Failed)
+	}
+	return sum
+}
+
+func TestRunPendingIgnoresSkippedDuplicates(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	writeTree(t, src, map[string]string{"x.pdf": "report"})
+	organize(t, src, dst)
+
+	writeTree(t, src, map[string]string{"a.txt": "same", "sub/a.txt": "same"})
+	organize(t, src, dst, WithDedupe(DedupeSkip))
+
+	runs, err := Runs(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 2 {
+		t.Fatalf("got %d runs, want 2", len(runs))
+	}
+	if got := runs[1].Pending(); got != 1 {
+		t.Fatalf("run with a skipped duplicate: Pending() = %d, want 1", got)
+	}
+
+	for range 2 {
+		if err := UndoLast(dst, 1, UndoOptions{Out: io.Discard}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(src, "x.pdf")); err != nil {
+		t.Errorf("the first run was not undone: %v", err)
+	}
+	runs, err = Runs(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range runs {
+		if r.Pending() != 0 {
+			t.Errorf("%s: Pending() = %d after undo, want 0", filepath.Base(r.Manifest), r.Pending())
+		}
+	}
+}
+
+func TestJournalRunCounts(t *testing.T) {
+	tests := []struct {
+		name    string
+		records string
+		want    Run
+		pending int
+	}{
+		{
+			name:    "placed",
+			records: `{"op":"intent","seq":1,"src":"a","dst":"b"}` + "\n" + `{"op":"done","seq":1}`,
+			want:    Run{Placed: 1},
+			pending: 1,
+		},
+		{
+			name:    "undone",
+			records: `{"op":"intent","seq":1,"src":"a","dst":"b"}` + "\n" + `{"op":"done","seq":1}` + "\n" + `{"op":"undone","seq":1}`,
+			want:    Run{Placed: 1, Undone: 1},
+		},
+		{
+			name:    "failed and rolled back",
+			records: `{"op":"intent","seq":1,"src":"a","dst":"b"}` + "\n" + `{"op":"failed","seq":1}` + "\n" + `{"op":"intent","seq":2,"src":"c","dst":"d"}` + "\n" + `{"op":"rolledback","seq":2}`,
+		},
+		{
+			name:    "in flight",
+			records: `{"op":"intent","seq":1,"src":"a","dst":"b"}`,
+			want:    Run{InFlight: 1},
+		},
+		{
+			name:    "duplicates",
+			records: `{"op":"intent","seq":1,"src":"a","dst":"b","action":"skip-duplicate"}` + "\n" + `{"op":"done","seq":1}` + "\n" + `{"op":"intent","seq":2,"src":"c","dst":"b","action":"delete-duplicate"}` + "\n" + `{"op":"done","seq":2}`,
+			want:    Run{Duplicates: 1},
+			pending: 1,
+		},
+		{
+			name:    "torn last line",
+			records: `{"op":"intent","seq":1,"src":"a","dst":"b"}` + "\n" + `{"op":"done","seq":1}` + "\n" + `{"op":"inte`,
+			want:    Run{Placed: 1},
+			pending: 1,
+		},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "moves-20240101-120000.jsonl")
+		if err := os.WriteFile(path, []byte(tt.records+"\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		got, err := journalRun(path)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		tt.want.Manifest, got.Started = path, time.Time{}
+		if got != tt.want || got.Pending() != tt.pending {
+			t.Errorf("%s: got %+v (pending %d), want %+v (pending %d)", tt.name, got, got.Pending(), tt.want, tt.pending)
+		}
+	}
+}
@@ -0,0 +1,272 @@
+package organizer
+
+import (
+	"bufio"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// ignoreFileName is read from every directory the walker visits.
+const ignoreFileName = ".organizerignore"
+
+// ignorePattern is one compiled gitignore-style line.
+type ignorePattern struct {
+	re      *regexp.Regexp
+	negate  bool // "!pattern" re-includes
+	dirOnly bool // "pattern/" only matches directories
+}
+
+// parseIgnorePattern compiles a line using gitignore rules. It returns
+// false for blank lines and comments.
+func parseIgnorePattern(line string) (ignorePattern, bool) {
+	line = strings.TrimRight(line, "\r")
+	// Trailing spaces are ignored unless escaped.
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, `\ `) {
+		line = line[:len(line)-1]
+	}
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignorePattern{}, false
+	}
+
+	var p ignorePattern
+	if strings.HasPrefix(line, "!") {
+		p.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		p.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return ignorePattern{}, false
+	}
+
+	// A slash anywhere but the end anchors the pattern to its base dir;
+	// otherwise it matches at any depth.
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+
+	var re strings.Builder
+	re.WriteString("^")
+	if !anchored {
+		re.WriteString("(?:.*/)?")
+	}
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case strings.HasPrefix(line[i:], "**/") && (i == 0 || line[i-1] == '/'):
+			re.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(line[i:], "**") && i+2 == len(line) && (i == 0 || line[i-1] == '/'):
+			re.WriteString(".*")
+			i++
+		case c == '*':
+			re.WriteString("[^/]*")
+		case c == '?':
+			re.WriteString("[^/]")
+		case c == '[':
+			if j := strings.IndexByte(line[i+1:], ']'); j >= 0 {
+				class := line[i+1 : i+1+j]
+				if strings.HasPrefix(class, "!") {
+					class = "^" + class[1:]
+				}
+				re.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+				i += j + 1
+			} else {
+				re.WriteString(`\[`)
+			}
+		case c == '\\' && i+1 < len(line):
+			i++
+			re.WriteString(regexp.QuoteMeta(string(line[i])))
+		default:
+			re.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	re.WriteString("$")
+
+	compiled, err := regexp.Compile(re.String())
+	if err != nil {
+		return ignorePattern{}, false
+	}
+	p.re = compiled
+	return p, true
+}
+
+func compilePatterns(lines []string) []ignorePattern {
+	var out []ignorePattern
+	for _, l := range lines {
+		if p, ok := parseIgnorePattern(l); ok {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// ignoreMatcher decides which paths under root the walker skips, from
+// .organizerignore files, --exclude and --include. Results for directories
+// are cached; it is safe for concurrent use by the walker and watcher.
+type ignoreMatcher struct {
+	fs       FS
+	root     string
+	excludes []ignorePattern // --exclude, relative to root, applied last
+	includes []ignorePattern // --include; if set, files must match one
+
+	mu    sync.Mutex
+	files map[string][]ignorePattern // dir -> patterns from its ignore file
+	dirs  map[string]bool            // dir -> ignored
+}
+
+func newIgnoreMatcher(fsys FS, root string, includes, excludes []string) *ignoreMatcher {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		abs = root
+	}
+	return &ignoreMatcher{
+		fs:       fsys,
+		root:     abs,
+		excludes: compilePatterns(excludes),
+		includes: compilePatterns(includes),
+		files:    make(map[string][]ignorePattern),
+		dirs:     make(map[string]bool),
+	}
+}
+
+// skipDir reports whether the walker should not descend into dir.
+func (m *ignoreMatcher) skipDir(dir string) bool {
+	abs, ok := m.abs(dir)
+	if !ok || abs == m.root {
+		return false
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.dirIgnored(abs)
+}
+
+// skipFile reports whether a file is excluded, either directly or because
+// one of its parent directories is.
+func (m *ignoreMatcher) skipFile(path string) bool {
+	abs, ok := m.abs(path)
+	if !ok {
+		return false
+	}
+	if filepath.Base(abs) == ignoreFileName {
+		return true
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if parent := filepath.Dir(abs); parent != m.root && m.dirIgnored(parent) {
+		return true
+	}
+	if m.matches(abs, false) {
+		return true
+	}
+	if len(m.includes) > 0 {
+		rel := m.rel(m.root, abs)
+		for _, p := range m.includes {
+			if !p.dirOnly && p.re.MatchString(rel) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// skipProject reports whether --include rules out a project directory,
+// which is matched by its own path since it moves as one unit. Exclusions
+// and ignore files are already covered by skipDir.
+func (m *ignoreMatcher) skipProject(dir string) bool {
+	abs, ok := m.abs(dir)
+	if !ok || len(m.includes) == 0 {
+		return false
+	}
+	rel := m.rel(m.root, abs)
+	for _, p := range m.includes {
+		if p.re.MatchString(rel) {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *ignoreMatcher) abs(path string) (string, bool) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", false
+	}
+	if abs != m.root && !strings.HasPrefix(abs, m.root+string(filepath.Separator)) {
+		return "", false
+	}
+	return abs, true
+}
+
+func (m *ignoreMatcher) rel(base, abs string) string {
+	r, _ := filepath.Rel(base, abs)
+	return filepath.ToSlash(r)
+}
+
+// dirIgnored is skipDir with m.mu held, recursing up so a directory inside
+// an ignored one is ignored too.
+func (m *ignoreMatcher) dirIgnored(abs string) bool {
+	if abs == m.root {
+		return false
+	}
+	if v, ok := m.dirs[abs]; ok {
+		return v
+	}
+	v := m.dirIgnored(filepath.Dir(abs)) || m.matches(abs, true)
+	m.dirs[abs] = v
+	return v
+}
+
+// matches applies every ignore file from root down to the path's parent,
+// then --exclude; like git, the last matching pattern wins.
+func (m *ignoreMatcher) matches(abs string, isDir bool) bool {
+	var chain []string
+	for d := filepath.Dir(abs); ; d = filepath.Dir(d) {
+		chain = append(chain, d)
+		if d == m.root || d == filepath.Dir(d) {
+			break
+		}
+	}
+
+	ignored := false
+	apply := func(pats []ignorePattern, base string) {
+		rel := m.rel(base, abs)
+		for _, p := range pats {
+			if p.dirOnly && !isDir {
+				continue
+			}
+			if p.re.MatchString(rel) {
+				ignored = !p.negate
+			}
+		}
+	}
+	for i := len(chain) - 1; i >= 0; i-- {
+		apply(m.load(chain[i]), chain[i])
+	}
+	apply(m.excludes, m.root)
+	return ignored
+}
+
+// load reads (once) the ignore file in dir.
+func (m *ignoreMatcher) load(dir string) []ignorePattern {
+	if pats, ok := m.files[dir]; ok {
+		return pats
+	}
+	var lines []string
+	if f, err := m.fs.Open(filepath.Join(dir, ignoreFileName)); err == nil {
+		sc := bufio.NewScanner(f)
+		for sc.Scan() {
+			lines = append(lines, sc.Text())
+		}
+		_ = f.Close()
+	}
+	pats := compilePatterns(lines)
+	m.files[dir] = pats
+	return pats
+}
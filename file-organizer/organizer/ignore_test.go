@@ -0,0 +1,92 @@
+package organizer
+
+import "testing"
+
+func TestIgnorePatterns(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string // relative to the pattern's directory
+		match   bool
+	}{
+		{"*.log", "debug.log", true},
+		{"*.log", "a/b/debug.log", true},
+		{"*.log", "debug.log.txt", false},
+		{"/top.txt", "top.txt", true},
+		{"/top.txt", "sub/top.txt", false},
+		{"docs/*.md", "docs/a.md", true},
+		{"docs/*.md", "docs/x/a.md", false},
+		{"docs/*.md", "x/docs/a.md", false},
+		{"docs/**/*.md", "docs/x/y/a.md", true},
+		{"**/cache", "a/b/cache", true},
+		{"build/**", "build/a/b.o", true},
+		{"file?.txt", "file1.txt", true},
+		{"file?.txt", "file10.txt", false},
+		{"[abc].txt", "b.txt", true},
+		{"[!abc].txt", "b.txt", false},
+		{`\#hash`, "#hash", true},
+		{"trailing   ", "trailing", true},
+	}
+	for _, tt := range tests {
+		p, ok := parseIgnorePattern(tt.pattern)
+		if !ok {
+			t.Errorf("%q: not parsed", tt.pattern)
+			continue
+		}
+		if got := p.re.MatchString(tt.path); got != tt.match {
+			t.Errorf("%q against %q = %v, want %v", tt.pattern, tt.path, got, tt.match)
+		}
+	}
+
+	for _, line := range []string{"", "# comment", "   ", "!", "/"} {
+		if _, ok := parseIgnorePattern(line); ok {
+			t.Errorf("%q: parsed, want it ignored", line)
+		}
+	}
+}
+
+func TestIgnoreMatcher(t *testing.T) {
+	m := memTree(t, map[string]string{
+		"src/.organizerignore":     "*.log\n!keep.log\nbuild/\n/root-only.txt\n",
+		"src/sub/.organizerignore": "*.tmp\n",
+		"src/sub/deeper/a.txt":     "",
+	})
+	tests := []struct {
+		path   string
+		isDir  bool
+		skip   bool
+		reason string
+	}{
+		{"/src/a.txt", false, false, "no pattern"},
+		{"/src/a.log", false, true, "*.log"},
+		{"/src/sub/x/a.log", false, true, "*.log at any depth"},
+		{"/src/keep.log", false, false, "re-included by !keep.log"},
+		{"/src/build", true, true, "build/"},
+		{"/src/build", false, false, "build/ matches only directories"},
+		{"/src/build/out/a.txt", false, true, "inside an ignored directory"},
+		{"/src/root-only.txt", false, true, "anchored"},
+		{"/src/sub/root-only.txt", false, false, "anchored to the root"},
+		{"/src/sub/a.tmp", false, true, "nested ignore file"},
+		{"/src/a.tmp", false, false, "nested ignore file doesn't apply above"},
+		{"/src/sub/.organizerignore", false, true, "ignore files themselves"},
+	}
+	im := newIgnoreMatcher(m, "/src", nil, []string{"sub/deeper/"})
+	for _, tt := range tests {
+		var got bool
+		if tt.isDir {
+			got = im.skipDir(tt.path)
+		} else {
+			got = im.skipFile(tt.path)
+		}
+		if got != tt.skip {
+			t.Errorf("%s (%s): skip = %v, want %v", tt.path, tt.reason, got, tt.skip)
+		}
+	}
+	if !im.skipDir("/src/sub/deeper") {
+		t.Error("-exclude sub/deeper/ did not skip the directory")
+	}
+
+	includes := newIgnoreMatcher(m, "/src", []string{"*.jpg"}, nil)
+	if includes.skipFile("/src/a/b.jpg") || !includes.skipFile("/src/a/b.txt") {
+		t.Error("-include *.jpg should keep only .jpg files")
+	}
+}
@@ -0,0 +1,554 @@
+package organizer
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Journal record ops. Every change is written (and fsynced) as an intent
+// before it happens and as done/failed afterwards, so a killed run leaves
+// an exact record of what was in flight.
+const (
+	opIntent     = "intent"
+	opDone       = "done"
+	opFailed     = "failed"
+	opRolledBack = "rolledback"
+	opUndone     = "undone" // appended by undo for each change it reverted
+)
+
+// errJournal marks failures to write the journal itself.
+var errJournal = errors.New("journal")
+
+// journalRecord is one line of a JSONL journal.
+type journalRecord struct {
+	Op       string    `json:"op"`
+	Seq      int64     `json:"seq"`
+	Src      string    `json:"src,omitempty"`
+	Dst      string    `json:"dst,omitempty"`
+	Action   string    `json:"action,omitempty"`
+	Backup   string    `json:"backup,omitempty"`
+	Mode     string    `json:"mode,omitempty"`
+	Group    string    `json:"group,omitempty"`
+	Category string    `json:"category,omitempty"`
+	Size     int64     `json:"size,omitempty"`
+	Hash     string    `json:"sha256,omitempty"`
+	When     time.Time `json:"when"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// journal is an append-only, fsynced JSONL manifest. It is safe for
+// concurrent use by workers; the file is created on the first record.
+type journal struct {
+	mu   sync.Mutex
+	path string
+	f    *os.File
+	seq  int64
+}
+
+func newJournal(dstRoot, prefix string) *journal {
+	name := fmt.Sprintf("%s-%s.jsonl", prefix, time.Now().Format("20060102-150405"))
+	return &journal{path: filepath.Join(dstRoot, manifestDirName, name)}
+}
+
+// create makes the journal file on first use. Runs started in the same
+// second pick the same name, so it is created exclusively and numbered on
+// a collision (moves-20240101-120000-2.jsonl); no two runs ever share a
+// journal or, named after it, a backup folder. Callers hold j.mu.
+func (j *journal) create() error {
+	if j.f != nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(j.path), 0o755); err != nil {
+		return err
+	}
+	base := strings.TrimSuffix(j.path, ".jsonl")
+	for i := 1; ; i++ {
+		path := j.path
+		if i > 1 {
+			path = fmt.Sprintf("%s-%d.jsonl", base, i)
+		}
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err == nil {
+			j.path, j.f = path, f
+			return nil
+		}
+		if !os.IsExist(err) || i == 10_000 {
+			return err
+		}
+	}
+}
+
+// reserve creates the journal if need be and returns its path, for what
+// is named after the run before its first record, like backups.
+func (j *journal) reserve() (string, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if err := j.create(); err != nil {
+		return "", err
+	}
+	return j.path, nil
+}
+
+// openJournalForAppend continues an existing journal, e.g. for --recover.
+func openJournalForAppend(path string) (*journal, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	// Terminate a torn last line so new records start on a line of their own.
+	if info, err := f.Stat(); err == nil && info.Size() > 0 {
+		last := make([]byte, 1)
+		if _, err := f.ReadAt(last, info.Size()-1); err == nil && last[0] != '\n' {
+			if _, err := f.Write([]byte{'\n'}); err != nil {
+				_ = f.Close()
+				return nil, err
+			}
+		}
+	}
+	return &journal{path: path, f: f}, nil
+}
+
+func (j *journal) append(rec journalRecord) error {
+	if err := j.create(); err != nil {
+		return err
+	}
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	if _, err := j.f.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return j.f.Sync()
+}
+
+// record journals m as an intent, runs apply, then journals the outcome.
+// If the intent can't be made durable, apply is not run.
+func (j *journal) record(m Move, apply func() error) error {
+	j.mu.Lock()
+	j.seq++
+	seq := j.seq
+	err := j.append(journalRecord{Op: opIntent, Seq: seq, Src: m.Src, Dst: m.Dst, Action: m.Action, Backup: m.Backup, Mode: m.Mode, Group: m.Group,
+		Category: m.Category, Size: m.Size, Hash: m.Hash, When: time.Now()})
+	j.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("%w: %w", errJournal, err)
+	}
+
+	applyErr := apply()
+
+	rec := journalRecord{Op: opDone, Seq: seq, When: time.Now()}
+	if applyErr != nil {
+		rec.Op, rec.Error = opFailed, applyErr.Error()
+	}
+	j.mu.Lock()
+	err = j.append(rec)
+	j.mu.Unlock()
+	if applyErr != nil {
+		return applyErr
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %w", errJournal, err)
+	}
+	return nil
+}
+
+// markUndone records that undo reverted change seq.
+func (j *journal) markUndone(seq int64) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.append(journalRecord{Op: opUndone, Seq: seq, When: time.Now()})
+}
+
+// journalName is a journal's file name without extension, e.g.
+// moves-20240101-120000.
+func journalName(path string) string {
+	return strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+}
+
+// used reports whether anything was written.
+func (j *journal) used() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.f != nil
+}
+
+func (j *journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.f == nil {
+		return nil
+	}
+	return j.f.Close()
+}
+
+// readJournal replays a journal. It returns the completed changes in the
+// order they were started and the intents that never got an outcome.
+// A torn last line (crash mid-write) is ignored.
+func readJournal(path string) (completed []Move, inflight []journalRecord, maxSeq int64, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	defer f.Close()
+
+	intents := make(map[int64]journalRecord)
+	var order []int64
+	outcome := make(map[int64]string)
+
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64<<10), 16<<20)
+	for sc.Scan() {
+		var rec journalRecord
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			continue
+		}
+		maxSeq = max(maxSeq, rec.Seq)
+		if rec.Op == opIntent {
+			intents[rec.Seq] = rec
+			order = append(order, rec.Seq)
+			continue
+		}
+		outcome[rec.Seq] = rec.Op
+	}
+	if err := sc.Err(); err != nil {
+		return nil, nil, 0, err
+	}
+
+	for _, seq := range order {
+		rec := intents[seq]
+		switch outcome[seq] {
+		case opDone:
+			completed = append(completed, Move{Src: rec.Src, Dst: rec.Dst, When: rec.When, Action: rec.Action, Backup: rec.Backup, Mode: rec.Mode,
+				Group: rec.Group, Category: rec.Category, Size: rec.Size, Hash: rec.Hash, seq: rec.Seq})
+		case "":
+			inflight = append(inflight, rec)
+		}
+	}
+	return completed, inflight, maxSeq, nil
+}
+
+// loadManifest reads either a JSONL journal or a legacy JSON manifest.
+func loadManifest(path string, w io.Writer) ([]Move, error) {
+	if strings.HasSuffix(path, ".jsonl") {
+		moves, inflight, _, err := readJournal(path)
+		if err != nil {
+			return nil, err
+		}
+		if len(inflight) > 0 {
+			fmt.Fprintf(w, "WARN   %d change(s) in %s never completed; recover it first\n", len(inflight), path)
+		}
+		return moves, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var moves []Move
+	if err := json.NewDecoder(f).Decode(&moves); err != nil {
+		return nil, err
+	}
+	return moves, nil
+}
+
+// Recover settles every change a crashed run left in flight in the
+// journal at path: ones that physically completed are marked done
+// (finishing a half-done cross-device move if needed), the rest are
+// rolled back. Each is reported to w. Copies that were still being
+// staged when the run died are removed as well.
+func Recover(path string, dryRun bool, w io.Writer) error {
+	_, inflight, maxSeq, err := readJournal(path)
+	if err != nil {
+		return err
+	}
+	if len(inflight) == 0 {
+		fmt.Fprintf(w, "Nothing to recover in %s\n", path)
+		return nil
+	}
+
+	var jr *journal
+	if !dryRun {
+		if jr, err = openJournalForAppend(path); err != nil {
+			return err
+		}
+		defer jr.Close()
+		jr.seq = maxSeq
+	}
+
+	var finished, rolledBack, failed int
+	swept := make(map[string]bool)
+	for _, rec := range inflight {
+		if dir := filepath.Dir(rec.Dst); !swept[dir] {
+			swept[dir] = true
+			for _, tmp := range sweepStaging(dir, dryRun) {
+				fmt.Fprintf(w, "%s %s (staged copy)\n", dryRunLabel(dryRun, "REMOVE"), tmp)
+			}
+		}
+		op, note, err := settleIntent(rec, dryRun)
+		switch {
+		case err != nil:
+			failed++
+			fmt.Fprintf(w, "ERROR  recover %s -> %s (%v)\n", rec.Src, rec.Dst, err)
+			continue
+		case op == opDone:
+			finished++
+			fmt.Fprintf(w, "%s %s -> %s (%s)\n", dryRunLabel(dryRun, "FINISH"), rec.Src, rec.Dst, note)
+		default:
+			rolledBack++
+			fmt.Fprintf(w, "%s %s -> %s (%s)\n", dryRunLabel(dryRun, "ROLLBK"), rec.Src, rec.Dst, note)
+		}
+		if jr != nil {
+			if err := jr.append(journalRecord{Op: op, Seq: rec.Seq, When: time.Now()}); err != nil {
+				return fmt.Errorf("%w: %w", errJournal, err)
+			}
+		}
+	}
+	fmt.Fprintf(w, "\nRecover summary: finished=%d rolledback=%d failed=%d\n", finished, rolledBack, failed)
+	return nil
+}
+
+// sweepStaging removes the staging files and folders in dir, which only
+// a run that died mid-copy leaves behind, and returns their paths.
+func sweepStaging(dir string, dryRun bool) []string {
+	entries, _ := os.ReadDir(dir)
+	var removed []string
+	for _, e := range entries {
+		if ok, _ := filepath.Match(stagingPattern, e.Name()); !ok {
+			continue
+		}
+		tmp := filepath.Join(dir, e.Name())
+		if !dryRun {
+			if err := os.RemoveAll(tmp); err != nil {
+				continue
+			}
+		}
+		removed = append(removed, tmp)
+	}
+	return removed
+}
+
+func dryRunLabel(dryRun bool, label string) string {
+	if dryRun {
+		return "DRYRUN " + label
+	}
+	return label
+}
+
+// settleIntent inspects the filesystem to decide how far an interrupted
+// change got and completes or reverses it.
+func settleIntent(rec journalRecord, dryRun bool) (op, note string, err error) {
+	if rec.Mode != "" {
+		return settlePlaced(rec, dryRun)
+	}
+	srcOK, dstOK := exists(OS, rec.Src), exists(OS, rec.Dst)
+
+	switch rec.Action {
+	case actionSkipDuplicate:
+		return opDone, "nothing was changed", nil
+
+	case actionDeleteDuplicate:
+		if !srcOK {
+			return opDone, "duplicate already deleted", nil
+		}
+		return opRolledBack, "duplicate still present", nil
+
+	case actionHardlink:
+		if !dryRun {
+			_ = os.Remove(rec.Src + ".organizer-link")
+		}
+		if srcOK && dstOK && sameInode(rec.Src, rec.Dst) {
+			return opDone, "link in place", nil
+		}
+		if !srcOK && dstOK {
+			if !dryRun {
+				if err := restoreCopy(rec.Dst, rec.Src); err != nil {
+					return "", "", err
+				}
+			}
+			return opRolledBack, "restored from kept copy", nil
+		}
+		return opRolledBack, "original untouched", nil
+
+	case actionOverwrite:
+		return settleOverwrite(rec, srcOK, dstOK, dryRun)
+
+	case actionExtract:
+		// The unpacked folder is put in place by one rename
+		if exists(OS, rec.Backup) {
+			if !dryRun {
+				if err := os.RemoveAll(rec.Backup); err != nil {
+					return "", "", err
+				}
+			}
+			return opRolledBack, "unpacked folder discarded", nil
+		}
+		if dstOK {
+			return opDone, "extraction had completed", nil
+		}
+		return "", "", errors.New("both the extracted folder and its staging folder are missing")
+
+	case actionProject:
+		// A directory only appears at dst once complete (rename or
+		// copyTree's final rename), so dst wins whenever it exists.
+		switch {
+		case dstOK && srcOK:
+			if !dryRun {
+				if err := os.RemoveAll(rec.Src); err != nil {
+					return "", "", err
+				}
+			}
+			return opDone, "copy complete, source removed", nil
+		case dstOK:
+			return opDone, "move had completed", nil
+		case srcOK:
+			return opRolledBack, "move never started", nil
+		}
+		return "", "", errors.New("both source and destination are missing")
+	}
+
+	// Plain moves and move-duplicate.
+	switch {
+	case !srcOK && dstOK:
+		return opDone, "move had completed", nil
+	case srcOK && !dstOK:
+		return opRolledBack, "move never started", nil
+	case srcOK && dstOK:
+		// Interrupted copy+remove fallback: keep the copy only if it is whole.
+		same, err := sameContent(OS, rec.Src, rec.Dst)
+		if err != nil {
+			return "", "", err
+		}
+		if same {
+			if !dryRun {
+				if err := os.Remove(rec.Src); err != nil {
+					return "", "", err
+				}
+			}
+			return opDone, "copy verified, source removed", nil
+		}
+		if !dryRun {
+			if err := os.Remove(rec.Dst); err != nil {
+				return "", "", err
+			}
+		}
+		return opRolledBack, "partial copy removed", nil
+	}
+	return "", "", errors.New("both source and destination are missing")
+}
+
+func sameInode(a, b string) bool {
+	ia, errA := os.Stat(a)
+	ib, errB := os.Stat(b)
+	return errA == nil && errB == nil && os.SameFile(ia, ib)
+}
+
+// sameContent compares two files by size and SHA-256.
+func sameContent(fsys FS, a, b string) (bool, error) {
+	ia, err := fsys.Stat(a)
+	if err != nil {
+		return false, err
+	}
+	ib, err := fsys.Stat(b)
+	if err != nil {
+		return false, err
+	}
+	if ia.Size() != ib.Size() {
+		return false, nil
+	}
+	ha, err := hashFile(fsys, a)
+	if err != nil {
+		return false, err
+	}
+	hb, err := hashFile(fsys, b)
+	if err != nil {
+		return false, err
+	}
+	return ha == hb, nil
+}
+
+// settleOverwrite handles an interrupted overwrite: the old target may be
+// in the backup, the new one may be missing or partially copied.
+func settleOverwrite(rec journalRecord, srcOK, dstOK, dryRun bool) (op, note string, err error) {
+	backupOK := exists(OS, rec.Backup)
+	restore := func() error {
+		if dryRun || !backupOK {
+			return nil
+		}
+		return os.Rename(rec.Backup, rec.Dst)
+	}
+
+	switch {
+	case !srcOK && dstOK:
+		return opDone, "overwrite had completed", nil
+	case srcOK && !dstOK:
+		if err := restore(); err != nil {
+			return "", "", err
+		}
+		return opRolledBack, "backup restored", nil
+	case srcOK && dstOK && !backupOK:
+		return opRolledBack, "overwrite never started", nil
+	case srcOK && dstOK:
+		same, err := sameContent(OS, rec.Src, rec.Dst)
+		if err != nil {
+			return "", "", err
+		}
+		if same {
+			if !dryRun {
+				if err := os.Remove(rec.Src); err != nil {
+					return "", "", err
+				}
+			}
+			return opDone, "copy verified, source removed", nil
+		}
+		if !dryRun {
+			if err := os.Remove(rec.Dst); err != nil {
+				return "", "", err
+			}
+		}
+		if err := restore(); err != nil {
+			return "", "", err
+		}
+		return opRolledBack, "partial copy removed, backup restored", nil
+	}
+	return "", "", errors.New("both source and destination are missing")
+}
+
+// settlePlaced handles an interrupted copy, symlink or hardlink. The source
+// is never at risk, so anything incomplete at dst is simply removed.
+func settlePlaced(rec journalRecord, dryRun bool) (op, note string, err error) {
+	check := isPlacedBy
+	if rec.Action == actionProject {
+		check = isPlacedDir
+	}
+	if _, err := os.Lstat(rec.Dst); err == nil {
+		if ok, _ := check(rec.Mode, rec.Src, rec.Dst); ok {
+			return opDone, rec.Mode + " had completed", nil
+		}
+		if rec.Action == actionOverwrite && !exists(OS, rec.Backup) {
+			// The backup was never taken, so dst is still the old target.
+			return opRolledBack, "overwrite never started", nil
+		}
+		if !dryRun {
+			if err := os.Remove(rec.Dst); err != nil {
+				return "", "", err
+			}
+		}
+	}
+	if rec.Action == actionOverwrite && exists(OS, rec.Backup) && !dryRun {
+		if err := os.Rename(rec.Backup, rec.Dst); err != nil {
+			return "", "", err
+		}
+	}
+	return opRolledBack, "incomplete " + rec.Mode + " removed", nil
+}
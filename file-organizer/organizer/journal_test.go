@@ -0,0 +1,79 @@
+package organizer
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRecoverSettlesInterruptedMoves(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	// a.txt was moved before the run was killed, b.txt never was, and a
+	// cross-device copy and a project copy were still being staged
+	writeTree(t, src, map[string]string{"b.txt": "b"})
+	writeTree(t, dst, map[string]string{
+		"Docs/a.txt":                        "a",
+		"Docs/.organizer-123.tmp":           "half a copy",
+		"Docs/.organizer-456.tmp/go.mod":    "module half",
+		"Docs/.organizer-restore-notes.txt": "not ours to remove",
+	})
+	var records []string
+	for i, name := range []string{"a.txt", "b.txt"} {
+		records = append(records, fmt.Sprintf(`{"op":"intent","seq":%d,"src":%q,"dst":%q}`,
+			i+1, filepath.Join(src, name), filepath.Join(dst, "Docs", name)))
+	}
+	manifest := filepath.Join(dst, manifestDirName, "moves-20240101-120000.jsonl")
+	writeTree(t, filepath.Dir(manifest), map[string]string{filepath.Base(manifest): strings.Join(records, "\n") + "\n"})
+
+	if err := Recover(manifest, false, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	r, err := journalRun(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.InFlight != 0 || r.Placed != 1 {
+		t.Fatalf("after recover: %+v, want 1 placed and none in flight", r)
+	}
+	for _, name := range []string{".organizer-123.tmp", ".organizer-456.tmp"} {
+		if exists(OS, filepath.Join(dst, "Docs", name)) {
+			t.Errorf("staged copy %s left behind", name)
+		}
+	}
+	if !exists(OS, filepath.Join(dst, "Docs", ".organizer-restore-notes.txt")) {
+		t.Error("removed a file that isn't a staged copy")
+	}
+
+	// The completed move is undone like any other
+	if err := Undo(manifest, UndoOptions{Out: io.Discard}); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a.txt", "b.txt"} {
+		if _, err := os.Stat(filepath.Join(src, name)); err != nil {
+			t.Errorf("%s not back in the source: %v", name, err)
+		}
+	}
+}
+
+func TestJournalNamesAreUnique(t *testing.T) {
+	dst := t.TempDir()
+	a, b := newJournal(dst, "moves"), newJournal(dst, "moves")
+	b.path = a.path // as if both started in the same second
+	for _, j := range []*journal{a, b} {
+		if err := j.record(Move{Src: "s", Dst: "d"}, func() error { return nil }); err != nil {
+			t.Fatal(err)
+		}
+		j.Close()
+	}
+	if a.path == b.path {
+		t.Fatalf("both runs journaled to %s", a.path)
+	}
+	for _, j := range []*journal{a, b} {
+		if r, err := journalRun(j.path); err != nil || r.Placed != 1 {
+			t.Errorf("%s: %+v, %v; want 1 placed", j.path, r, err)
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package organizer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// DefaultLayout reproduces the original flat dstRoot/<category>/<name> layout.
+const DefaultLayout = "{category}/{name}{ext}"
+
+// layoutVars lists the variables a --layout template may use, with the
+// pattern each one matches when recognising already-organized folders.
+var layoutVars = map[string]string{
+	"category": `[^/]+`,
+	"name":     `[^/]*`,
+	"ext":      `[^/]*`,
+	"year":     `\d{4}`,
+	"month":    `\d{2}`,
+	"day":      `\d{2}`,
+	"date":     `\d{4}-\d{2}-\d{2}`,
+
+	// EXIF-backed variables; "Unknown" when the file has no EXIF.
+	"exif.year":        `\d{4}|Unknown`,
+	"exif.month":       `\d{2}|Unknown`,
+	"exif.day":         `\d{2}|Unknown`,
+	"exif.date":        `\d{4}-\d{2}-\d{2}|Unknown`,
+	"exif.make":        `[^/]+`,
+	"exif.model":       `[^/]+`,
+	"exif.orientation": `[1-8]|Unknown`,
+	"camera":           `[^/]+`,
+}
+
+// dateVars are the variables that need a file date to render.
+var dateVars = map[string]bool{"year": true, "month": true, "day": true, "date": true}
+
+var layoutVarRe = regexp.MustCompile(`\{([a-z.]+)\}`)
+
+// layout is a compiled --layout path template such as
+// "{category}/{year}/{month}/{name}{ext}".
+type layout struct {
+	tmpl      string
+	dirs      []*regexp.Regexp // one per directory segment, for matchesDir
+	catIndex  []int            // capture group of {category} in each dir segment, 0 = none
+	file      *regexp.Regexp   // the file name segment, for categoryOf
+	fileCat   int              // capture group of {category} in it, 0 = none
+	needsDate bool
+	needsExif bool
+}
+
+func parseLayout(tmpl string) (*layout, error) {
+	tmpl = filepath.ToSlash(strings.TrimSpace(tmpl))
+	if tmpl == "" {
+		tmpl = DefaultLayout
+	}
+	if strings.HasPrefix(tmpl, "/") {
+		return nil, fmt.Errorf("layout %q must be relative", tmpl)
+	}
+
+	l := &layout{tmpl: tmpl}
+	segs := strings.Split(tmpl, "/")
+	for i, seg := range segs {
+		if seg == "" || seg == "." || seg == ".." {
+			return nil, fmt.Errorf("layout %q: invalid path segment %q", tmpl, seg)
+		}
+		var re strings.Builder
+		re.WriteString("^")
+		catIdx, group, last := 0, 0, 0
+		for _, m := range layoutVarRe.FindAllStringSubmatchIndex(seg, -1) {
+			name := seg[m[2]:m[3]]
+			pat, ok := layoutVars[name]
+			if !ok {
+				return nil, fmt.Errorf("layout %q: unknown variable {%s}", tmpl, name)
+			}
+			if dateVars[name] {
+				l.needsDate = true
+			}
+			if name == "camera" || strings.HasPrefix(name, "exif.") {
+				l.needsExif = true
+			}
+			re.WriteString(regexp.QuoteMeta(seg[last:m[0]]))
+			group++
+			if name == "category" {
+				catIdx = group
+			}
+			re.WriteString("(" + pat + ")")
+			last = m[1]
+		}
+		re.WriteString(regexp.QuoteMeta(seg[last:]))
+		re.WriteString("$")
+		if i < len(segs)-1 {
+			l.dirs = append(l.dirs, regexp.MustCompile(re.String()))
+			l.catIndex = append(l.catIndex, catIdx)
+		} else {
+			l.file, l.fileCat = regexp.MustCompile(re.String()), catIdx
+		}
+	}
+	if !strings.Contains(tmpl, "{category}") {
+		return nil, fmt.Errorf("layout %q must include {category}", tmpl)
+	}
+	return l, nil
+}
+
+// render fills in the template and returns a clean relative path. Values
+// are sanitised so they can never add or escape path segments: separators
+// become "_", and so does a value or segment that is empty, "." or "..".
+func (l *layout) render(vars map[string]string) (string, error) {
+	segs := strings.Split(l.tmpl, "/")
+	for i, seg := range segs {
+		seg = layoutVarRe.ReplaceAllStringFunc(seg, func(tok string) string {
+			return layoutValue(vars[tok[1:len(tok)-1]])
+		})
+		if seg == "" || seg == "." || seg == ".." {
+			seg = "_"
+		}
+		segs[i] = seg
+	}
+	rel := filepath.Join(segs...)
+	if !filepath.IsLocal(rel) {
+		return "", fmt.Errorf("layout %q rendered invalid path %q", l.tmpl, rel)
+	}
+	return rel, nil
+}
+
+// layoutValue makes a variable's value safe to substitute into a segment.
+func layoutValue(v string) string {
+	v = strings.NewReplacer("/", "_", `\`, "_").Replace(v)
+	if v == "." || v == ".." {
+		return "_"
+	}
+	return v
+}
+
+func (l *layout) matchesDir(rel string, c Classifier) bool {
+	segs := strings.Split(filepath.ToSlash(rel), "/")
+	if len(segs)-1 < len(l.dirs) {
+		return false
+	}
+	for i, re := range l.dirs {
+		m := re.FindStringSubmatch(segs[i])
+		if m == nil {
+			return false
+		}
+		if l.catIndex[i] > 0 && !isCategory(c, m[l.catIndex[i]]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Date sources for {year}/{month}/{day} (WithDateFrom, --date-from).
+const (
+	DateFromAuto  = "auto" // metadata, then filename, then mtime
+	DateFromMtime = "mtime"
+	DateFromName  = "name"
+	DateFromMeta  = "meta"
+)
+
+// fileDate picks the date used for {year}/{month}/{day}. Sources that find
+// nothing fall back to mtime so every file gets a date.
+func fileDate(fsys FS, path string, info os.FileInfo, from string) time.Time {
+	if from == DateFromAuto || from == DateFromMeta {
+		if t, ok := metadataDate(fsys, path); ok {
+			return t
+		}
+	}
+	if from == DateFromAuto || from == DateFromName {
+		if t, ok := dateFromFilename(info.Name()); ok {
+			return t
+		}
+	}
+	return info.ModTime()
+}
+
+// Matches YYYYMMDD / YYYY-MM-DD / YYYY_MM_DD / YYYY.MM.DD not embedded in a
+// longer run of digits: IMG_20230104_101530.jpg, Screenshot 2024-05-01 at ….
+var filenameDateRe = regexp.MustCompile(`(?:^|\D)((?:19|20)\d{2})[-_.]?(0[1-9]|1[0-2])[-_.]?(0[1-9]|[12]\d|3[01])(?:\D|$)`)
+
+func dateFromFilename(name string) (time.Time, bool) {
+	m := filenameDateRe.FindStringSubmatch(name)
+	if m == nil {
+		return time.Time{}, false
+	}
+	t, err := time.ParseInLocation("2006-01-02", m[1]+"-"+m[2]+"-"+m[3], time.Local)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// dateLayoutVars fills the date variables for t.
+func dateLayoutVars(vars map[string]string, t time.Time) {
+	vars["year"] = t.Format("2006")
+	vars["month"] = t.Format("01")
+	vars["day"] = t.Format("02")
+	vars["date"] = t.Format("2006-01-02")
+}
+
+// mayHold reports whether files this layout places can be in or under
+// the folder rel (relative to dstRoot), so walks can skip the rest.
+func (l *layout) mayHold(rel string, c Classifier) bool {
+	for i, seg := range strings.Split(filepath.ToSlash(rel), "/") {
+		if i == len(l.dirs) {
+			return true
+		}
+		m := l.dirs[i].FindStringSubmatch(seg)
+		if m == nil || (l.catIndex[i] > 0 && !isCategory(c, m[l.catIndex[i]])) {
+			return false
+		}
+	}
+	return true
+}
+
+// categoryOf is the category the layout filed the file at rel under,
+// taken from its folders or, for layouts that only name it there, its
+// file name. Files deeper than the layout goes, like the contents of an
+// extracted archive, belong to the category of their folders.
+func (l *layout) categoryOf(rel string, c Classifier) (string, bool) {
+	segs := strings.Split(filepath.ToSlash(rel), "/")
+	if len(segs) <= len(l.dirs) {
+		return "", false
+	}
+	category := ""
+	for i, re := range l.dirs {
+		m := re.FindStringSubmatch(segs[i])
+		if m == nil {
+			return "", false
+		}
+		if l.catIndex[i] > 0 {
+			category = m[l.catIndex[i]]
+		}
+	}
+	if category == "" && l.fileCat > 0 && len(segs) == len(l.dirs)+1 {
+		if m := l.file.FindStringSubmatch(segs[len(l.dirs)]); m != nil {
+			category = m[l.fileCat]
+		}
+	}
+	return category, category != "" && isCategory(c, category)
+}
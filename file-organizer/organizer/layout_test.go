@@ -0,0 +1,43 @@
+package organizer
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestLayoutRender(t *testing.T) {
+	tests := []struct {
+		tmpl string
+		vars map[string]string
+		want string
+	}{
+		{DefaultLayout, map[string]string{"category": "Docs", "name": "a", "ext": ".txt"}, "Docs/a.txt"},
+		{DefaultLayout, map[string]string{"category": "Docs", "name": "README"}, "Docs/README"},
+		{"{category}/{year}/{name}{ext}", map[string]string{"category": "Docs", "year": "2024", "name": "a", "ext": ".txt"}, "Docs/2024/a.txt"},
+
+		// Values can't add segments
+		{"{category}/{exif.make}/{name}{ext}", map[string]string{"category": "Images", "exif.make": "A/B", "name": "a", "ext": ".jpg"}, "Images/A_B/a.jpg"},
+		{"{category}/{exif.make}/{name}{ext}", map[string]string{"category": "Images", "exif.make": `A\B`, "name": "a", "ext": ".jpg"}, `Images/A_B/a.jpg`},
+
+		// or climb out of them
+		{"{category}/{exif.make}/{name}{ext}", map[string]string{"category": "Images", "exif.make": "..", "name": "a", "ext": ".jpg"}, "Images/_/a.jpg"},
+		{"{category}/{exif.model}/{name}{ext}", map[string]string{"category": "Images", "exif.model": ".", "name": "a", "ext": ".jpg"}, "Images/_/a.jpg"},
+		{"{category}/{exif.make}{exif.model}/{name}{ext}", map[string]string{"category": "Images", "exif.make": ".", "exif.model": ".", "name": "a"}, "Images/__/a"},
+		{"{category}/{name}{ext}", map[string]string{"category": "..", "name": "..", "ext": ""}, "_/_"},
+		{"{category}/{name}{ext}", map[string]string{"category": "Docs", "name": ".", "ext": "."}, "Docs/__"},
+
+		// or vanish
+		{"{category}/{exif.make}/{name}{ext}", map[string]string{"category": "Images", "name": "a", "ext": ".jpg"}, "Images/_/a.jpg"},
+		{"{category}/{name}{ext}", map[string]string{"category": ""}, "_/_"},
+	}
+	for _, tt := range tests {
+		l, err := parseLayout(tt.tmpl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := l.render(tt.vars)
+		if err != nil || got != filepath.FromSlash(tt.want) {
+			t.Errorf("%s with %v = %q, %v; want %q", tt.tmpl, tt.vars, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package organizer
+
+import (
+	"bytes"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// MemFS is an in-memory FS for fast, deterministic tests and simulations.
+// It starts out with just the root directory; populate it with MkdirAll
+// and WriteFile. Only ModeMove can place files on it, and runs on it keep
+// no manifest.
+type MemFS struct {
+	mu    sync.Mutex
+	nodes map[string]*memNode // by clean absolute path
+}
+
+type memNode struct {
+	data    []byte
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+// NewMemFS returns an empty MemFS.
+func NewMemFS() *MemFS {
+	root := string(filepath.Separator)
+	return &MemFS{nodes: map[string]*memNode{root: {mode: fs.ModeDir | 0o755, modTime: time.Now()}}}
+}
+
+func memPath(name string) string {
+	return filepath.Join(string(filepath.Separator), name)
+}
+
+// WriteFile creates or replaces a file; its parent must exist.
+func (m *MemFS) WriteFile(name string, data []byte, perm fs.FileMode, modTime time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p := memPath(name)
+	if parent, ok := m.nodes[filepath.Dir(p)]; !ok || !parent.mode.IsDir() {
+		return &fs.PathError{Op: "write", Path: name, Err: fs.ErrNotExist}
+	}
+	if n, ok := m.nodes[p]; ok && n.mode.IsDir() {
+		return &fs.PathError{Op: "write", Path: name, Err: syscall.EISDIR}
+	}
+	m.nodes[p] = &memNode{data: bytes.Clone(data), mode: perm.Perm(), modTime: modTime}
+	return nil
+}
+
+func (m *MemFS) Stat(name string) (fs.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p := memPath(name)
+	n, ok := m.nodes[p]
+	if !ok {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+	return memInfo{name: filepath.Base(p), node: n}, nil
+}
+
+// Lstat is Stat: MemFS has no symlinks.
+func (m *MemFS) Lstat(name string) (fs.FileInfo, error) {
+	return m.Stat(name)
+}
+
+func (m *MemFS) Open(name string) (File, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p := memPath(name)
+	n, ok := m.nodes[p]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return &memFile{Reader: bytes.NewReader(n.data), info: memInfo{name: filepath.Base(p), node: n}}, nil
+}
+
+func (m *MemFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p := memPath(name)
+	if n, ok := m.nodes[p]; !ok || !n.mode.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	var out []fs.DirEntry
+	for q, n := range m.nodes {
+		if q != p && filepath.Dir(q) == p {
+			out = append(out, fs.FileInfoToDirEntry(memInfo{name: filepath.Base(q), node: n}))
+		}
+	}
+	sort.Slice(out, func(a, b int) bool { return out[a].Name() < out[b].Name() })
+	return out, nil
+}
+
+// Rename moves a file or a whole directory. Like os.Rename on Unix, it
+// replaces an existing file but not a non-empty directory.
+func (m *MemFS) Rename(oldpath, newpath string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	from, to := memPath(oldpath), memPath(newpath)
+	n, ok := m.nodes[from]
+	if !ok {
+		return &fs.PathError{Op: "rename", Path: oldpath, Err: fs.ErrNotExist}
+	}
+	if parent, ok := m.nodes[filepath.Dir(to)]; !ok || !parent.mode.IsDir() {
+		return &fs.PathError{Op: "rename", Path: newpath, Err: fs.ErrNotExist}
+	}
+	if from == to {
+		return nil
+	}
+	if strings.HasPrefix(to, from+string(filepath.Separator)) {
+		return &fs.PathError{Op: "rename", Path: newpath, Err: syscall.EINVAL}
+	}
+	if old, ok := m.nodes[to]; ok && old.mode.IsDir() && (!n.mode.IsDir() || m.hasChildren(to)) {
+		return &fs.PathError{Op: "rename", Path: newpath, Err: syscall.EEXIST}
+	}
+	m.nodes[to] = n
+	delete(m.nodes, from)
+	if n.mode.IsDir() {
+		prefix := from + string(filepath.Separator)
+		for q, c := range m.nodes {
+			if strings.HasPrefix(q, prefix) {
+				m.nodes[filepath.Join(to, strings.TrimPrefix(q, prefix))] = c
+				delete(m.nodes, q)
+			}
+		}
+	}
+	return nil
+}
+
+func (m *MemFS) hasChildren(dir string) bool {
+	prefix := dir + string(filepath.Separator)
+	for q := range m.nodes {
+		if strings.HasPrefix(q, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *MemFS) MkdirAll(path string, perm fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p := memPath(path)
+	var missing []string
+	for ; ; p = filepath.Dir(p) {
+		if n, ok := m.nodes[p]; ok {
+			if !n.mode.IsDir() {
+				return &fs.PathError{Op: "mkdir", Path: p, Err: syscall.ENOTDIR}
+			}
+			break
+		}
+		missing = append(missing, p)
+	}
+	for _, d := range missing {
+		m.nodes[d] = &memNode{mode: fs.ModeDir | perm.Perm(), modTime: time.Now()}
+	}
+	return nil
+}
+
+// Remove deletes a file or an empty directory.
+func (m *MemFS) Remove(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p := memPath(name)
+	if _, ok := m.nodes[p]; !ok {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+	if m.hasChildren(p) {
+		return &fs.PathError{Op: "remove", Path: name, Err: syscall.ENOTEMPTY}
+	}
+	delete(m.nodes, p)
+	return nil
+}
+
+func (m *MemFS) Walk(root string, fn filepath.WalkFunc) error {
+	return walkFS(m, root, fn)
+}
+
+type memInfo struct {
+	name string
+	node *memNode
+}
+
+func (i memInfo) Name() string       { return i.name }
+func (i memInfo) Size() int64        { return int64(len(i.node.data)) }
+func (i memInfo) Mode() fs.FileMode  { return i.node.mode }
+func (i memInfo) ModTime() time.Time { return i.node.modTime }
+func (i memInfo) IsDir() bool        { return i.node.mode.IsDir() }
+func (i memInfo) Sys() any           { return nil }
+
+type memFile struct {
+	*bytes.Reader
+	info memInfo
+}
+
+func (f *memFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *memFile) Close() error               { return nil }
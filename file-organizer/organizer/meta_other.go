@@ -0,0 +1,16 @@
+//go:build !linux && !darwin
+
+package organizer
+
+import (
+	"os"
+	"time"
+)
+
+// Ownership and xattrs are only carried over on Linux and macOS.
+
+func copyOwnership(info os.FileInfo, dst string) error { return nil }
+
+func copyXattrs(src, dst string) error { return nil }
+
+func accessTime(info os.FileInfo) time.Time { return info.ModTime() }
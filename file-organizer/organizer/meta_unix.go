@@ -0,0 +1,73 @@
+//go:build linux || darwin
+
+package organizer
+
+import (
+	"errors"
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// copyOwnership applies src's uid/gid to dst. Unprivileged users can't give
+// files away, so EPERM is only an error when running as root.
+func copyOwnership(info os.FileInfo, dst string) error {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+	err := os.Lchown(dst, int(st.Uid), int(st.Gid))
+	if errors.Is(err, os.ErrPermission) && os.Geteuid() != 0 {
+		return nil
+	}
+	return err
+}
+
+// copyXattrs copies every extended attribute from src to dst. Filesystems
+// without xattr support are treated as having none.
+func copyXattrs(src, dst string) error {
+	size, err := unix.Listxattr(src, nil)
+	if err != nil || size == 0 {
+		if errors.Is(err, unix.ENOTSUP) {
+			return nil
+		}
+		return err
+	}
+	buf := make([]byte, size)
+	if size, err = unix.Listxattr(src, buf); err != nil {
+		return err
+	}
+	for _, name := range splitXattrNames(buf[:size]) {
+		vsize, err := unix.Getxattr(src, name, nil)
+		if err != nil {
+			return err
+		}
+		val := make([]byte, vsize)
+		if vsize, err = unix.Getxattr(src, name, val); err != nil {
+			return err
+		}
+		if err := unix.Setxattr(dst, name, val[:vsize], 0); err != nil {
+			// Security/system namespaces may be off-limits to us.
+			if errors.Is(err, unix.EPERM) || errors.Is(err, unix.ENOTSUP) {
+				continue
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func splitXattrNames(buf []byte) []string {
+	var names []string
+	start := 0
+	for i, b := range buf {
+		if b == 0 {
+			if i > start {
+				names = append(names, string(buf[start:i]))
+			}
+			start = i + 1
+		}
+	}
+	return names
+}
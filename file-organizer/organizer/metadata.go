@@ -0,0 +1,72 @@
+package organizer
+
+import (
+	"io"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// metaScanLen bounds how much of the head and tail of a file is searched
+// for embedded dates.
+const metaScanLen = 64 << 10
+
+// metadataDate returns the creation date embedded in a file, if its format
+// is one we know how to read.
+func metadataDate(fsys FS, path string) (time.Time, bool) {
+	ext := strings.ToLower(filepath.Ext(path))
+	switch {
+	case ext == ".pdf":
+		return pdfCreationDate(fsys, path)
+	case exifExts[ext]:
+		if x, err := readExif(fsys, path); err == nil && !x.Taken.IsZero() {
+			return x.Taken, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// /CreationDate (D:YYYYMMDDHHmmSS…) in the document info dictionary, which
+// is usually near the start or the end of the file.
+var pdfDateRe = regexp.MustCompile(`/CreationDate\s*\(D:(\d{4})(\d{2})?(\d{2})?(\d{2})?(\d{2})?(\d{2})?`)
+
+func pdfCreationDate(fsys FS, path string) (time.Time, bool) {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return time.Time{}, false
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return time.Time{}, false
+	}
+	var chunks [][]byte
+	head := make([]byte, metaScanLen)
+	n, _ := io.ReadFull(f, head)
+	chunks = append(chunks, head[:n])
+	if info.Size() > metaScanLen {
+		tail := make([]byte, metaScanLen)
+		n, _ := f.ReadAt(tail, info.Size()-metaScanLen)
+		chunks = append(chunks, tail[:n])
+	}
+
+	for _, c := range chunks {
+		m := pdfDateRe.FindSubmatch(c)
+		if m == nil {
+			continue
+		}
+		parts := []string{string(m[1]), "01", "01", "00", "00", "00"}
+		for i := 2; i <= 6; i++ {
+			if len(m[i]) > 0 {
+				parts[i-1] = string(m[i])
+			}
+		}
+		t, err := time.ParseInLocation("20060102150405", strings.Join(parts, ""), time.Local)
+		if err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
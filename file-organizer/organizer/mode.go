@@ -0,0 +1,129 @@
+package organizer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Placement modes (WithMode, --mode). Only move touches the source tree;
+// the others build an organized view next to it.
+const (
+	ModeMove     = "move"
+	ModeCopy     = "copy"
+	ModeSymlink  = "symlink"
+	ModeHardlink = "hardlink"
+)
+
+func validMode(m string) bool {
+	switch m {
+	case ModeMove, ModeCopy, ModeSymlink, ModeHardlink:
+		return true
+	}
+	return false
+}
+
+// Mover places one file, or a whole project directory, at its
+// destination. Mode names the placement mode it implements; manifests
+// record it so undo knows whether to move the file back or to remove a
+// copy or link.
+type Mover interface {
+	Mode() string
+	Place(src, dst string) error
+}
+
+// modeMover is the built-in Mover of a mode.
+type modeMover string
+
+func (m modeMover) Mode() string { return string(m) }
+
+func (m modeMover) Place(src, dst string) error {
+	if fi, err := os.Lstat(src); err == nil && fi.IsDir() {
+		return placeDir(string(m), src, dst)
+	}
+	return placeFile(string(m), src, dst)
+}
+
+// manifestMode is the Move.Mode recorded for a mode; moves leave it empty
+// so older manifests keep meaning "move".
+func manifestMode(mode string) string {
+	if mode == ModeMove {
+		return ""
+	}
+	return mode
+}
+
+// placeFile puts src at dst according to mode.
+func placeFile(mode, src, dst string) error {
+	switch mode {
+	case ModeCopy:
+		if err := copyFile(src, dst); err != nil {
+			_ = os.Remove(dst)
+			return err
+		}
+		return nil
+	case ModeSymlink:
+		abs, err := filepath.Abs(src)
+		if err != nil {
+			return err
+		}
+		return os.Symlink(abs, dst)
+	case ModeHardlink:
+		return os.Link(src, dst)
+	}
+	return moveFile(OS, src, dst)
+}
+
+// isPlacedBy reports whether dst is still exactly what mode created from
+// src. Undo only ever deletes a copy or link when this holds, and never
+// touches the original.
+func isPlacedBy(mode, src, dst string) (bool, error) {
+	switch mode {
+	case ModeCopy:
+		if !exists(OS, src) {
+			// Without the original the copy is the only one left.
+			return false, fmt.Errorf("original %s is gone; keeping copy", src)
+		}
+		same, err := sameContent(OS, src, dst)
+		if err == nil && !same {
+			return false, fmt.Errorf("copy was modified since it was made")
+		}
+		return same, err
+	case ModeSymlink:
+		fi, err := os.Lstat(dst)
+		if err != nil {
+			return false, err
+		}
+		if fi.Mode()&os.ModeSymlink == 0 {
+			return false, fmt.Errorf("no longer a symlink")
+		}
+		target, err := os.Readlink(dst)
+		if err != nil {
+			return false, err
+		}
+		abs, _ := filepath.Abs(src)
+		return target == abs, nil
+	case ModeHardlink:
+		if !exists(OS, src) {
+			return false, fmt.Errorf("original %s is gone; keeping link", src)
+		}
+		return sameInode(src, dst), nil
+	}
+	return false, fmt.Errorf("unknown mode %q", mode)
+}
+
+// undoPlaced removes a copy or link created by a non-move mode.
+func undoPlaced(m Move) error {
+	check := isPlacedBy
+	if m.Action == actionProject {
+		check = isPlacedDir
+	}
+	ok, err := check(m.Mode, m.Src, m.Dst)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%s no longer matches %s", m.Dst, m.Src)
+	}
+	return removePlaced(m)
+}
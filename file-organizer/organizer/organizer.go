@@ -0,0 +1,709 @@
+// Package organizer sorts files into category folders. It is the engine
+// behind the file-organizer command: an Organizer walks a source tree (and
+// optionally keeps watching it), classifies every file and places it under
+// a destination root, journaling each change so that an interrupted run
+// can be recovered and any run can be undone.
+package organizer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Event actions besides the duplicate actions (see IsDuplicateAction).
+// A failed file has its Err set instead.
+const (
+	ActionPlace = "move" // placed according to the mode: moved, copied or linked
+	ActionSkip  = "skip"
+)
+
+// Event reports what happened to one file or project directory.
+type Event struct {
+	Action   string
+	Src      string
+	Dst      string
+	DupOf    string // kept copy, for duplicate actions
+	Renamed  string // the taken target, when a name conflict put the file at Dst instead
+	Category string
+	Group    string // primary's source path, for files placed as a group
+	Note     string // extra detail, e.g. "sidecar of IMG_1.CR2"
+	Bytes    int64
+	Elapsed  time.Duration
+	DryRun   bool
+	Err      error
+}
+
+// Summary is the outcome of a Run. Placed counts moved, copied or linked
+// files depending on the mode.
+type Summary struct {
+	Placed     int
+	Skipped    int
+	Failed     int
+	Duplicates int
+	Expired    int // moved to the trash by retention rules
+	Extracted  int // archives unpacked
+	Bytes      int64
+	Elapsed    time.Duration
+
+	// Manifest is the journal of the run, for Undo; empty for dry runs
+	// and runs that changed nothing.
+	Manifest string
+	// Plan is what a dry run would have done, ready to Write.
+	Plan *Plan
+	// Interrupted is set when ctx was cancelled before all work was done
+	// (except in watch mode, where that is the normal way to stop); the
+	// counts cover what completed.
+	Interrupted bool
+}
+
+func (s *Summary) add(r result) {
+	switch {
+	case r.err != nil:
+		s.Failed++
+	case r.action == ActionPlace:
+		s.Placed++
+		s.Bytes += r.bytes
+	case r.action == ActionSkip:
+		s.Skipped++
+	case IsDuplicateAction(r.action):
+		s.Duplicates++
+	case r.action == ActionExpire:
+		s.Expired++
+	case r.action == ActionExtract:
+		s.Extracted++
+	}
+}
+
+// Organizer organizes one source tree into a destination root. Configure
+// it with options; it can be Run more than once.
+type Organizer struct {
+	src, dst      string
+	fs            FS
+	dryRun        bool
+	workers       int
+	includeHidden bool
+	rules         *RuleSet
+	classifier    Classifier
+	mover         Mover
+	layout        *layout
+	dateFrom      string
+	dedupe        string
+	onConflict    string
+	sniff, fixExt bool
+
+	includes, excludes   []string
+	maxDepth             int
+	minSize, maxSize     int64
+	olderThan, newerThan time.Time
+	sinceLastRun         bool
+	statePath            string
+
+	noProjects bool
+	markers    []string
+	noSidecars bool
+
+	retention []RetentionRule
+	extract   extractConfig
+
+	watch  bool
+	settle time.Duration
+	plan   *Plan
+
+	onEvent    func(Event)
+	onDiscover func(path string, size int64)
+	log        io.Writer
+}
+
+// Option configures an Organizer.
+type Option func(*Organizer) error
+
+// New returns an Organizer for src; dst is the destination root ("" means
+// src itself). With WithPlan, the plan's source, destination, mode and
+// conflict policy are used instead.
+func New(src, dst string, opts ...Option) (*Organizer, error) {
+	lay, err := parseLayout(DefaultLayout)
+	if err != nil {
+		return nil, err
+	}
+	o := &Organizer{
+		src:        src,
+		dst:        dst,
+		fs:         OS,
+		workers:    8,
+		rules:      DefaultRules(),
+		mover:      modeMover(ModeMove),
+		layout:     lay,
+		dateFrom:   DateFromAuto,
+		onConflict: ConflictRename,
+		maxDepth:   -1,
+		extract:    extractConfig{maxBytes: DefaultExtractMaxBytes, maxFiles: DefaultExtractMaxFiles},
+		settle:     5 * time.Second,
+		log:        io.Discard,
+	}
+	for _, opt := range opts {
+		if err := opt(o); err != nil {
+			return nil, err
+		}
+	}
+	if o.plan != nil {
+		if o.watch {
+			return nil, errors.New("a plan can't be applied in watch mode")
+		}
+		o.src, o.dst, o.onConflict = o.plan.Src, o.plan.Dest, o.plan.OnConflict
+		if !validMode(o.plan.Mode) || !validConflictPolicy(o.plan.OnConflict) {
+			return nil, fmt.Errorf("plan has invalid mode %q or conflict policy %q", o.plan.Mode, o.plan.OnConflict)
+		}
+		if _, builtin := o.mover.(modeMover); builtin {
+			o.mover = modeMover(o.plan.Mode)
+		}
+	}
+	if o.dst == "" {
+		o.dst = o.src
+	}
+	if o.classifier == nil {
+		o.classifier = o.rules
+	}
+	o.retention = append(append([]RetentionRule(nil), o.rules.retention...), o.retention...)
+	for _, r := range o.retention {
+		if !isCategory(o.classifier, r.Category) {
+			return nil, fmt.Errorf("retention rule %q: unknown category %q", r.String(), r.Category)
+		}
+	}
+	if !validMode(o.mover.Mode()) {
+		return nil, fmt.Errorf("mover has invalid mode %q", o.mover.Mode())
+	}
+	if o.mover.Mode() != ModeMove && o.dedupe != "" && o.dedupe != DedupeSkip {
+		return nil, fmt.Errorf("dedupe %s changes the source tree; only skip works with mode %s", o.dedupe, o.mover.Mode())
+	}
+	if !onOS(o.fs) {
+		// Copies, links, fsnotify and the journal need real files
+		switch {
+		case o.mover.Mode() != ModeMove:
+			return nil, fmt.Errorf("mode %s needs the OS filesystem", o.mover.Mode())
+		case o.dedupe == DedupeHardlink:
+			return nil, fmt.Errorf("dedupe %s needs the OS filesystem", o.dedupe)
+		case o.watch:
+			return nil, errors.New("watch mode needs the OS filesystem")
+		case len(o.retention) > 0:
+			return nil, errors.New("retention rules need the OS filesystem")
+		case o.extract.originals != "":
+			return nil, errors.New("extraction needs the OS filesystem")
+		}
+	}
+	if o.extract.originals == ExtractTrash && o.mover.Mode() != ModeMove {
+		return nil, fmt.Errorf("mode %s leaves the source alone; extracted archives can only be trashed with mode move", o.mover.Mode())
+	}
+	if o.watch && len(o.retention) > 0 {
+		return nil, errors.New("retention rules can't be used in watch mode")
+	}
+	for _, dir := range []string{o.src, o.dst} {
+		info, err := o.fs.Stat(dir)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			return nil, fmt.Errorf("%q is not a directory", dir)
+		}
+	}
+	return o, nil
+}
+
+// WithDryRun reports what would be done without changing anything.
+func WithDryRun(dryRun bool) Option {
+	return func(o *Organizer) error {
+		o.dryRun = dryRun
+		return nil
+	}
+}
+
+// WithFS organizes a tree on fsys instead of the OS filesystem. Only
+// ModeMove works there; nothing is journaled and no state file is kept,
+// so such runs can't be undone or recovered.
+func WithFS(fsys FS) Option {
+	return func(o *Organizer) error {
+		o.fs = fsys
+		return nil
+	}
+}
+
+// WithWorkers sets how many files are handled concurrently (default 8).
+func WithWorkers(n int) Option {
+	return func(o *Organizer) error {
+		if n < 1 {
+			return fmt.Errorf("invalid worker count %d", n)
+		}
+		o.workers = n
+		return nil
+	}
+}
+
+// WithIncludeHidden organizes hidden files and directories too.
+func WithIncludeHidden(include bool) Option {
+	return func(o *Organizer) error {
+		o.includeHidden = include
+		return nil
+	}
+}
+
+// WithRules classifies with rs and groups sidecars by its sidecar rules.
+func WithRules(rs *RuleSet) Option {
+	return func(o *Organizer) error {
+		o.rules = rs
+		return nil
+	}
+}
+
+// WithClassifier replaces the rule set's classification.
+func WithClassifier(c Classifier) Option {
+	return func(o *Organizer) error {
+		o.classifier = c
+		return nil
+	}
+}
+
+// WithMode places files with the built-in mover for mode: ModeMove
+// (default), ModeCopy, ModeSymlink or ModeHardlink.
+func WithMode(mode string) Option {
+	return func(o *Organizer) error {
+		if !validMode(mode) {
+			return fmt.Errorf("invalid mode %q (want move, copy, symlink or hardlink)", mode)
+		}
+		o.mover = modeMover(mode)
+		return nil
+	}
+}
+
+// WithMover places files with m instead of a built-in mode.
+func WithMover(m Mover) Option {
+	return func(o *Organizer) error {
+		o.mover = m
+		return nil
+	}
+}
+
+// WithLayout sets the destination path template, e.g.
+// {category}/{year}/{month}/{name}{ext}.
+func WithLayout(tmpl string) Option {
+	return func(o *Organizer) error {
+		lay, err := parseLayout(tmpl)
+		if err != nil {
+			return err
+		}
+		o.layout = lay
+		return nil
+	}
+}
+
+// WithDateFrom picks the date source for {year}/{month}/{day}.
+func WithDateFrom(source string) Option {
+	return func(o *Organizer) error {
+		switch source {
+		case DateFromAuto, DateFromMtime, DateFromName, DateFromMeta:
+		default:
+			return fmt.Errorf("invalid date source %q (want auto, mtime, name or meta)", source)
+		}
+		o.dateFrom = source
+		return nil
+	}
+}
+
+// WithDedupe detects duplicate content and applies policy to duplicates;
+// "" turns detection off.
+func WithDedupe(policy string) Option {
+	return func(o *Organizer) error {
+		if !validDedupePolicy(policy) {
+			return fmt.Errorf("invalid dedupe policy %q (want skip, delete-source, hardlink or move-to)", policy)
+		}
+		o.dedupe = policy
+		return nil
+	}
+}
+
+// WithConflictPolicy decides what happens when a target already exists.
+func WithConflictPolicy(policy string) Option {
+	return func(o *Organizer) error {
+		if !validConflictPolicy(policy) {
+			return fmt.Errorf("invalid conflict policy %q (want rename, skip, overwrite, keep-newer, keep-larger or hash-compare)", policy)
+		}
+		o.onConflict = policy
+		return nil
+	}
+}
+
+// WithSniff classifies by content when the extension is missing or
+// wrong; with fixExt the file is given the detected extension.
+func WithSniff(fixExt bool) Option {
+	return func(o *Organizer) error {
+		o.sniff, o.fixExt = true, fixExt
+		return nil
+	}
+}
+
+// WithIncludes only organizes files matching one of these gitignore-style
+// globs.
+func WithIncludes(globs ...string) Option {
+	return func(o *Organizer) error {
+		o.includes = append(o.includes, globs...)
+		return nil
+	}
+}
+
+// WithExcludes skips paths matching these gitignore-style patterns, on
+// top of any .organizerignore files.
+func WithExcludes(patterns ...string) Option {
+	return func(o *Organizer) error {
+		o.excludes = append(o.excludes, patterns...)
+		return nil
+	}
+}
+
+// WithMaxDepth limits how many directory levels below src are walked
+// (-1, the default, is unlimited; 0 is the top level only).
+func WithMaxDepth(depth int) Option {
+	return func(o *Organizer) error {
+		o.maxDepth = depth
+		return nil
+	}
+}
+
+// WithSizeRange skips files smaller than min or larger than max (0 = no
+// limit).
+func WithSizeRange(min, max int64) Option {
+	return func(o *Organizer) error {
+		o.minSize, o.maxSize = min, max
+		return nil
+	}
+}
+
+// WithModTimeRange only organizes files modified after newerThan and
+// before olderThan; a zero time is no limit.
+func WithModTimeRange(newerThan, olderThan time.Time) Option {
+	return func(o *Organizer) error {
+		o.newerThan, o.olderThan = newerThan, olderThan
+		return nil
+	}
+}
+
+// WithSinceLastRun only organizes files modified since the last run over
+// the same source, as recorded in the state file.
+func WithSinceLastRun() Option {
+	return func(o *Organizer) error {
+		o.sinceLastRun = true
+		return nil
+	}
+}
+
+// WithStateFile sets where last runs are recorded (default
+// <dst>/.organizer-manifests/state.json).
+func WithStateFile(path string) Option {
+	return func(o *Organizer) error {
+		o.statePath = path
+		return nil
+	}
+}
+
+// WithProjectMarkers adds markers (filepath.Match globs) that make a
+// directory a project, besides .git, go.mod, package.json and *.xcodeproj.
+func WithProjectMarkers(markers ...string) Option {
+	return func(o *Organizer) error {
+		o.markers = append(o.markers, markers...)
+		return nil
+	}
+}
+
+// WithoutProjects organizes the files of project directories one by one
+// instead of moving each project whole.
+func WithoutProjects() Option {
+	return func(o *Organizer) error {
+		o.noProjects = true
+		return nil
+	}
+}
+
+// WithoutSidecars organizes sidecar files (.xmp, .srt, RAW+JPG pairs) on
+// their own instead of with their primary file.
+func WithoutSidecars() Option {
+	return func(o *Organizer) error {
+		o.noSidecars = true
+		return nil
+	}
+}
+
+// WithWatch keeps running after the first pass, organizing new files once
+// they have stayed unchanged for settle, until ctx is cancelled.
+func WithWatch(settle time.Duration) Option {
+	return func(o *Organizer) error {
+		o.watch, o.settle = true, settle
+		return nil
+	}
+}
+
+// WithPlan carries out a plan (see LoadPlan) instead of walking the source.
+func WithPlan(p *Plan) Option {
+	return func(o *Organizer) error {
+		o.plan = p
+		return nil
+	}
+}
+
+// OnEvent calls fn for every event, in order, from the goroutine running
+// Run; a slow fn slows the run down.
+func OnEvent(fn func(Event)) Option {
+	return func(o *Organizer) error {
+		o.onEvent = fn
+		return nil
+	}
+}
+
+// OnDiscover calls fn for every file or project queued for handling,
+// before its event, so callers can show progress against the total known
+// so far. Sidecars are reported like any other file; projects have size
+// -1 as their size is known only from their event. fn is called from the
+// walker's goroutine, concurrently with OnEvent.
+func OnDiscover(fn func(path string, size int64)) Option {
+	return func(o *Organizer) error {
+		o.onDiscover = fn
+		return nil
+	}
+}
+
+// WithLog sets where notes that aren't events go, such as warnings and
+// the start of watching. They are discarded by default.
+func WithLog(w io.Writer) Option {
+	return func(o *Organizer) error {
+		o.log = w
+		return nil
+	}
+}
+
+func (o *Organizer) logf(format string, a ...any) {
+	fmt.Fprintf(o.log, format+"\n", a...)
+}
+
+// newConfig sets up what walking the source needs: filters (including
+// the last-run cutoff from the state file, which it returns with its
+// path) and classification.
+func (o *Organizer) newConfig() (*config, *runState, string, error) {
+	projects, err := newProjectDetector(o.noProjects, o.markers)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	filter := &walkFilter{root: o.src, maxDepth: o.maxDepth, minSize: o.minSize, maxSize: o.maxSize,
+		olderThan: o.olderThan, newerThan: o.newerThan}
+	statePath := o.statePath
+	if statePath == "" {
+		statePath = defaultStatePath(o.dst)
+	}
+	state := &runState{LastRun: make(map[string]time.Time)}
+	if onOS(o.fs) {
+		if state, err = loadRunState(statePath); err != nil {
+			return nil, nil, "", err
+		}
+	}
+	if o.sinceLastRun {
+		if last, ok := state.LastRun[stateKey(o.src)]; ok && last.After(filter.newerThan) {
+			filter.newerThan = last
+		}
+	}
+
+	cfg := &config{
+		fs:            o.fs,
+		dstRoot:       o.dst,
+		dryRun:        o.dryRun,
+		includeHidden: o.includeHidden,
+		ignore:        newIgnoreMatcher(o.fs, o.src, o.includes, o.excludes),
+		filter:        filter,
+		projects:      projects,
+		sidecars:      !o.noSidecars,
+		rules:         o.rules,
+		classifier:    o.classifier,
+		sniff:         o.sniff,
+		fixExt:        o.fixExt,
+		layout:        o.layout,
+		dateFrom:      o.dateFrom,
+		dedupe:        o.dedupe,
+		onConflict:    o.onConflict,
+		mover:         o.mover,
+		discover:      o.onDiscover,
+	}
+	if o.extract.originals != "" {
+		cfg.extract = &o.extract
+	}
+	return cfg, state, statePath, nil
+}
+
+// Run organizes the source tree once, or until ctx is cancelled in watch
+// mode. Cancelling ctx stops the walk and any work not yet started;
+// changes in flight finish and are journaled as usual.
+func (o *Organizer) Run(ctx context.Context) (*Summary, error) {
+	runStart := time.Now()
+	cfg, state, statePath, err := o.newConfig()
+	if err != nil {
+		return nil, err
+	}
+	if o.dryRun {
+		// Dry runs place files in an overlay, so later conflicts see them
+		cfg.sim = NewOverlay(o.fs)
+		cfg.fs = cfg.sim
+	}
+	if o.dedupe != "" {
+		cfg.dedupeIdx = newDedupeIndex(cfg)
+	}
+	if !o.dryRun && onOS(o.fs) {
+		prefix := "moves"
+		if o.watch {
+			prefix = "watch"
+		}
+		cfg.journal = newJournal(o.dst, prefix)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Producer/consumer channels
+	jobs := make(chan job, 256)
+	results := make(chan result, 256)
+
+	// Start workers
+	var wg sync.WaitGroup
+	for i := 0; i < o.workers; i++ {
+		wg.Add(1)
+		go worker(ctx, &wg, jobs, results, cfg)
+	}
+
+	// Walk in a separate goroutine so we can consume results concurrently.
+	// In watch mode the walk is just the first pass; the watcher keeps
+	// feeding the same jobs channel until ctx is cancelled.
+	producerDone := make(chan struct{})
+	go func() {
+		defer close(producerDone)
+		defer close(jobs)
+		if o.plan != nil {
+			queuePlan(ctx, cfg, o.plan, jobs, results)
+			return
+		}
+		walkSource(ctx, o.src, cfg, jobs, results)
+		if !o.watch || ctx.Err() != nil {
+			return
+		}
+		o.logf("Watching %s (settle %s)", o.src, o.settle)
+		if err := watchSource(ctx, o.src, cfg, o.settle, jobs, results); err != nil {
+			results <- result{srcPath: o.src, err: err}
+		}
+	}()
+
+	// Collector: close results once nothing can send any more
+	go func() {
+		wg.Wait()
+		<-producerDone
+		close(results)
+	}()
+
+	var planned *Plan
+	if o.dryRun {
+		planned = &Plan{Version: planVersion, Created: runStart, Src: absPath(o.src), Dest: absPath(o.dst), Mode: o.mover.Mode(), OnConflict: o.onConflict}
+	}
+
+	start := time.Now()
+	sum := &Summary{}
+	for r := range results {
+		sum.add(r)
+		if planned != nil {
+			planned.add(r)
+		}
+		if o.onEvent != nil {
+			o.onEvent(r.event(o.dryRun))
+		}
+	}
+	sum.Interrupted = ctx.Err() != nil && !o.watch
+	if !sum.Interrupted {
+		sum.Plan = planned
+	}
+
+	// Retention runs last, so it sees what this run placed too
+	if len(o.retention) > 0 && !sum.Interrupted {
+		expire(ctx, cfg, o.retention, time.Now(), func(r result) {
+			sum.add(r)
+			if o.onEvent != nil {
+				o.onEvent(r.event(o.dryRun))
+			}
+		}, o.logf)
+	}
+
+	// The journal was written as we went; it is the manifest for undo
+	if cfg.journal != nil {
+		if err := cfg.journal.Close(); err != nil {
+			o.logf("WARN   failed to close manifest: %v", err)
+		}
+		if cfg.journal.used() {
+			sum.Manifest = cfg.journal.path
+		}
+	}
+
+	// Remember this run for WithSinceLastRun. The start time is used so
+	// files changed while we were running are picked up next time.
+	if !o.dryRun && !sum.Interrupted && onOS(o.fs) {
+		last := runStart
+		if o.plan != nil {
+			// Files changed after planning were not part of the plan
+			last = o.plan.Created
+		}
+		state.LastRun[stateKey(o.src)] = last
+		if err := state.save(statePath); err != nil {
+			o.logf("WARN   failed to save state: %v", err)
+		}
+	}
+	sum.Elapsed = time.Since(start)
+	return sum, nil
+}
+
+func (r result) event(dryRun bool) Event {
+	return Event{Action: r.action, Src: r.srcPath, Dst: r.dstPath, DupOf: r.dupOf, Renamed: r.renamed, Category: r.category, Group: r.group,
+		Note: r.note, Bytes: r.bytes, Elapsed: r.elapsed, DryRun: dryRun, Err: r.err}
+}
+
+// ErrorCode gives an Event's error a stable, scriptable name.
+func ErrorCode(err error) string {
+	var errno syscall.Errno
+	switch {
+	case errors.Is(err, errChecksum):
+		return "checksum_mismatch"
+	case errors.Is(err, errSourceChanged):
+		return "source_changed"
+	case errors.Is(err, errJournal):
+		return "journal"
+	case errors.Is(err, errPlanStale):
+		return "stale"
+	case errors.Is(err, errUnsafeArchive):
+		return "unsafe_archive"
+	case errors.Is(err, errBadArchive):
+		return "bad_archive"
+	case errors.Is(err, fs.ErrNotExist):
+		return "not_found"
+	case errors.Is(err, fs.ErrExist):
+		return "exists"
+	case errors.Is(err, fs.ErrPermission):
+		return "permission_denied"
+	case errors.As(err, &errno):
+		switch errno {
+		case syscall.ENOSPC:
+			return "no_space"
+		case syscall.EXDEV:
+			return "cross_device"
+		case syscall.EROFS:
+			return "read_only"
+		case syscall.ENAMETOOLONG:
+			return "name_too_long"
+		case syscall.ENOTEMPTY:
+			return "not_empty"
+		}
+		return "io_error"
+	}
+	return "error"
+}
@@ -0,0 +1,175 @@
+package organizer
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+var testTime = time.Date(2023, 5, 17, 12, 0, 0, 0, time.UTC)
+
+// memTree returns a MemFS with /src and /dst and files (path relative to
+// / -> content) in it, all modified at testTime, directories included.
+func memTree(t *testing.T, files map[string]string) *MemFS {
+	t.Helper()
+	m := NewMemFS()
+	for _, dir := range []string{"/src", "/dst"} {
+		if err := m.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(files)) {
+		p := memPath(name)
+		if err := m.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := m.WriteFile(p, []byte(files[name]), 0o644, testTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, n := range m.nodes {
+		n.modTime = testTime
+	}
+	return m
+}
+
+// memFiles lists every file in fsys by path (relative to /) and content.
+func memFiles(t *testing.T, fsys FS) map[string]string {
+	t.Helper()
+	out := make(map[string]string)
+	err := fsys.Walk("/", func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		f, err := fsys.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		data := make([]byte, info.Size())
+		if _, err := f.ReadAt(data, 0); err != nil && info.Size() > 0 {
+			return err
+		}
+		out[path[1:]] = string(data)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+// runMem organizes /src into /dst on m.
+func runMem(t *testing.T, m *MemFS, opts ...Option) *Summary {
+	t.Helper()
+	o, err := New("/src", "/dst", append([]Option{WithFS(m), WithWorkers(4)}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum, err := o.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sum
+}
+
+func TestRunOnMemFS(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		opts  []Option
+		want  map[string]string
+	}{
+		{
+			name:  "categories",
+			files: map[string]string{"src/a.pdf": "a", "src/b.jpg": "b", "src/deep/c.mp3": "c", "src/d.unknownext": "d"},
+			want:  map[string]string{"dst/Docs/a.pdf": "a", "dst/Images/b.jpg": "b", "dst/Audio/c.mp3": "c", "dst/Other/d.unknownext": "d"},
+		},
+		{
+			name:  "name conflict renamed",
+			files: map[string]string{"src/a.txt": "new", "dst/Docs/a.txt": "old"},
+			want:  map[string]string{"dst/Docs/a.txt": "old", "dst/Docs/a (1).txt": "new"},
+		},
+		{
+			name:  "name conflict skipped",
+			files: map[string]string{"src/a.txt": "new", "dst/Docs/a.txt": "old"},
+			opts:  []Option{WithConflictPolicy(ConflictSkip)},
+			want:  map[string]string{"src/a.txt": "new", "dst/Docs/a.txt": "old"},
+		},
+		{
+			name:  "date layout",
+			files: map[string]string{"src/a.txt": "a"},
+			opts:  []Option{WithLayout("{category}/{year}/{month}/{name}{ext}"), WithDateFrom(DateFromMtime)},
+			want:  map[string]string{"dst/Docs/2023/05/a.txt": "a"},
+		},
+		{
+			name:  "excludes",
+			files: map[string]string{"src/a.txt": "a", "src/debug.log": "l", "src/tmp/b.txt": "b"},
+			opts:  []Option{WithExcludes("*.log", "tmp/")},
+			want:  map[string]string{"dst/Docs/a.txt": "a", "src/debug.log": "l", "src/tmp/b.txt": "b"},
+		},
+		{
+			name:  "duplicates moved aside",
+			files: map[string]string{"src/a.txt": "same", "dst/Docs/b.txt": "same"},
+			opts:  []Option{WithDedupe(DedupeMoveTo)},
+			want:  map[string]string{"dst/Docs/b.txt": "same", "dst/Duplicates/a.txt": "same"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := memTree(t, tt.files)
+			sum := runMem(t, m, tt.opts...)
+			if sum.Failed > 0 {
+				t.Fatalf("%d file(s) failed", sum.Failed)
+			}
+			if got := memFiles(t, m); !maps.Equal(got, tt.want) {
+				t.Errorf("got  %v\nwant %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOverlay(t *testing.T) {
+	files := map[string]string{"src/a.txt": "a", "src/dir/b.txt": "b", "src/dir/c.txt": "c", "src/gone.txt": "g"}
+	m := memTree(t, files)
+	o := NewOverlay(m)
+	for _, step := range []error{
+		o.MkdirAll("/dst/Docs", 0o755),
+		o.Rename("/src/a.txt", "/dst/Docs/a.txt"),
+		o.Rename("/src/dir", "/dst/dir"),
+		o.Rename("/dst/dir/c.txt", "/src/c.txt"),
+		o.Remove("/src/gone.txt"),
+	} {
+		if step != nil {
+			t.Fatal(step)
+		}
+	}
+	o.link("/dst/Docs/a.txt", "/dst/Docs/copy.txt")
+
+	want := map[string]string{"dst/Docs/a.txt": "a", "dst/Docs/copy.txt": "a", "dst/dir/b.txt": "b", "src/c.txt": "c"}
+	if got := memFiles(t, o); !maps.Equal(got, want) {
+		t.Errorf("overlay: got  %v\nwant %v", got, want)
+	}
+	if got := memFiles(t, m); !maps.Equal(got, files) {
+		t.Errorf("base changed: %v", got)
+	}
+
+	if info, err := o.Stat("/dst/Docs/a.txt"); err != nil || info.Name() != "a.txt" || info.Size() != 1 {
+		t.Errorf("stat of a moved file = %v, %v", info, err)
+	}
+	if _, err := o.Stat("/src/dir/b.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("stat under a moved directory: err = %v, want not exist", err)
+	}
+	if err := o.Remove("/dst/dir"); err == nil {
+		t.Error("removed a non-empty directory")
+	}
+	if err := o.Rename("/src/c.txt", "/nowhere/c.txt"); err == nil {
+		t.Error("renamed into a missing directory")
+	}
+}
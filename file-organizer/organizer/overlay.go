@@ -0,0 +1,256 @@
+package organizer
+
+import (
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Overlay is a read-only view of another FS that records changes in
+// memory instead of making them. Dry runs go through one, so a simulated
+// placement is visible to the placements after it: conflicts get the
+// exact " (n)" names a real run would pick.
+type Overlay struct {
+	base FS
+
+	mu      sync.Mutex
+	entries map[string]ovEntry // by clean path; nearest one on a path wins
+}
+
+// ovEntry is a change at a path: the path is gone (whiteout), is a new
+// directory, or now shows what origin is in the base FS.
+type ovEntry struct {
+	whiteout bool
+	dir      bool
+	origin   string
+}
+
+// NewOverlay returns an Overlay over base.
+func NewOverlay(base FS) *Overlay {
+	return &Overlay{base: base, entries: make(map[string]ovEntry)}
+}
+
+// resolve maps name to where it lives: its base path, or dir for a
+// directory that only exists in the overlay. ok is false if the overlay
+// hides it.
+func (o *Overlay) resolve(name string) (basePath string, dir, ok bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.resolveLocked(filepath.Clean(name))
+}
+
+func (o *Overlay) resolveLocked(name string) (string, bool, bool) {
+	for p := name; ; p = filepath.Dir(p) {
+		if e, ok := o.entries[p]; ok {
+			switch {
+			case e.whiteout:
+				return "", false, false
+			case e.dir:
+				// Only overlay entries live under a new directory
+				return "", p == name, p == name
+			}
+			if p == name {
+				return e.origin, false, true
+			}
+			return filepath.Join(e.origin, strings.TrimPrefix(name, p+string(filepath.Separator))), false, true
+		}
+		if filepath.Dir(p) == p {
+			return name, false, true
+		}
+	}
+}
+
+func (o *Overlay) Stat(name string) (fs.FileInfo, error) {
+	return o.stat("stat", name, o.base.Stat)
+}
+
+func (o *Overlay) Lstat(name string) (fs.FileInfo, error) {
+	return o.stat("lstat", name, o.base.Lstat)
+}
+
+func (o *Overlay) stat(op, name string, stat func(string) (fs.FileInfo, error)) (fs.FileInfo, error) {
+	p, dir, ok := o.resolve(name)
+	if !ok {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	if dir {
+		return newDirInfo(name), nil
+	}
+	info, err := stat(p)
+	if err != nil {
+		return nil, &fs.PathError{Op: op, Path: name, Err: underlying(err)}
+	}
+	if info.Name() != filepath.Base(name) {
+		info = ovInfo{info, filepath.Base(name)}
+	}
+	return info, nil
+}
+
+func (o *Overlay) Open(name string) (File, error) {
+	p, dir, ok := o.resolve(name)
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	if dir {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: syscall.EISDIR}
+	}
+	return o.base.Open(p)
+}
+
+// ReadDir merges the base directory with what the overlay added and hid.
+func (o *Overlay) ReadDir(name string) ([]fs.DirEntry, error) {
+	name = filepath.Clean(name)
+	info, err := o.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: syscall.ENOTDIR}
+	}
+	names := make(map[string]bool)
+	if p, dir, _ := o.resolve(name); !dir {
+		entries, err := o.base.ReadDir(p)
+		if err != nil {
+			return nil, &fs.PathError{Op: "readdir", Path: name, Err: underlying(err)}
+		}
+		for _, e := range entries {
+			names[e.Name()] = true
+		}
+	}
+	o.mu.Lock()
+	for p := range o.entries {
+		if filepath.Dir(p) == name && p != name {
+			names[filepath.Base(p)] = true
+		}
+	}
+	o.mu.Unlock()
+
+	var out []fs.DirEntry
+	for n := range names {
+		if fi, err := o.Lstat(filepath.Join(name, n)); err == nil {
+			out = append(out, fs.FileInfoToDirEntry(fi))
+		}
+	}
+	sort.Slice(out, func(a, b int) bool { return out[a].Name() < out[b].Name() })
+	return out, nil
+}
+
+func (o *Overlay) Rename(oldpath, newpath string) error {
+	from, to := filepath.Clean(oldpath), filepath.Clean(newpath)
+	if _, err := o.Lstat(from); err != nil {
+		return &fs.PathError{Op: "rename", Path: oldpath, Err: fs.ErrNotExist}
+	}
+	if fi, err := o.Stat(filepath.Dir(to)); err != nil || !fi.IsDir() {
+		return &fs.PathError{Op: "rename", Path: newpath, Err: fs.ErrNotExist}
+	}
+	if from == to {
+		return nil
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	p, dir, _ := o.resolveLocked(from)
+	o.dropLocked(to)
+	o.entries[to] = ovEntry{dir: dir, origin: p}
+	prefix := from + string(filepath.Separator)
+	for q, e := range o.entries {
+		if strings.HasPrefix(q, prefix) {
+			o.entries[filepath.Join(to, strings.TrimPrefix(q, prefix))] = e
+			delete(o.entries, q)
+		}
+	}
+	o.entries[from] = ovEntry{whiteout: true}
+	return nil
+}
+
+func (o *Overlay) MkdirAll(path string, perm fs.FileMode) error {
+	var missing []string
+	for p := filepath.Clean(path); ; p = filepath.Dir(p) {
+		if fi, err := o.Stat(p); err == nil {
+			if !fi.IsDir() {
+				return &fs.PathError{Op: "mkdir", Path: p, Err: syscall.ENOTDIR}
+			}
+			break
+		}
+		missing = append(missing, p)
+		if filepath.Dir(p) == p {
+			break
+		}
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for _, d := range missing {
+		o.entries[d] = ovEntry{dir: true}
+	}
+	return nil
+}
+
+func (o *Overlay) Remove(name string) error {
+	name = filepath.Clean(name)
+	fi, err := o.Lstat(name)
+	if err != nil {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+	if fi.IsDir() {
+		if entries, err := o.ReadDir(name); err != nil || len(entries) > 0 {
+			return &fs.PathError{Op: "remove", Path: name, Err: syscall.ENOTEMPTY}
+		}
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.dropLocked(name)
+	o.entries[name] = ovEntry{whiteout: true}
+	return nil
+}
+
+func (o *Overlay) Walk(root string, fn filepath.WalkFunc) error {
+	return walkFS(o, root, fn)
+}
+
+// link makes dst show what src shows, the way a copy or link placed by a
+// non-move mode would.
+func (o *Overlay) link(src, dst string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	p, dir, ok := o.resolveLocked(filepath.Clean(src))
+	if !ok {
+		return
+	}
+	dst = filepath.Clean(dst)
+	o.dropLocked(dst)
+	o.entries[dst] = ovEntry{dir: dir, origin: p}
+}
+
+// dropLocked forgets every entry under dir.
+func (o *Overlay) dropLocked(dir string) {
+	prefix := dir + string(filepath.Separator)
+	for q := range o.entries {
+		if strings.HasPrefix(q, prefix) {
+			delete(o.entries, q)
+		}
+	}
+}
+
+// underlying unwraps a PathError so it can be reported under the
+// overlay's path rather than the base one.
+func underlying(err error) error {
+	if pe, ok := err.(*fs.PathError); ok {
+		return pe.Err
+	}
+	return err
+}
+
+// ovInfo renames the FileInfo of a moved file.
+type ovInfo struct {
+	fs.FileInfo
+	name string
+}
+
+func (i ovInfo) Name() string { return i.name }
+
+func newDirInfo(name string) fs.FileInfo {
+	return memInfo{name: filepath.Base(name), node: &memNode{mode: fs.ModeDir | 0o755, modTime: time.Now()}}
+}
@@ -0,0 +1,570 @@
+package organizer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+type job struct {
+	srcPath   string
+	info      os.FileInfo
+	sidecars  []job        // files grouped with this primary; they go where it goes
+	plan      *PlanEntry   // set when applying a plan: what was decided for this file
+	extracted bool         // came out of an archive; never unpacked in turn
+	dup       *dedupeEntry // its dedupe entry, settled once it is placed
+	done      func()       // if set, called once the job's results are sent
+}
+
+type result struct {
+	srcPath string
+	dstPath string
+	err     error
+	action  string // "move", "skip" or one of the duplicate actions
+	dupOf   string // kept copy, for duplicate actions
+	renamed string // taken target, when a name conflict put the file at dstPath instead
+	note    string // extra detail for the console line
+	bytes   int64
+	elapsed time.Duration
+
+	// For plans: what the file was classified as and, for groups, the
+	// primary's source path.
+	category string
+	group    string
+	info     os.FileInfo
+
+	sidecars []result // outcomes for the job's sidecars
+	after    []result // changes that followed, e.g. unpacking an archive
+}
+
+// config carries the run-wide settings every worker needs.
+type config struct {
+	fs            FS       // an Overlay in dry-run
+	sim           *Overlay // the dry-run overlay; nil otherwise
+	dstRoot       string
+	dryRun        bool
+	includeHidden bool
+	ignore        *ignoreMatcher
+	filter        *walkFilter
+	projects      *projectDetector // nil = project detection off
+	sidecars      bool             // keep RAW+JPG+XMP, video+subtitle sets together
+	rules         *RuleSet         // sidecar rules
+	classifier    Classifier       // picks categories; the rule set unless replaced
+	sniff         bool             // classify by magic number when the extension is missing or wrong
+	fixExt        bool             // with sniff: rename to the detected extension
+
+	layout   *layout
+	dateFrom string // auto, mtime, name or meta
+
+	dedupe    string // "" (off) or a dedupe policy
+	dedupeIdx *dedupeIndex
+
+	mover      Mover
+	onConflict string
+
+	journal  *journal                      // nil in dry-run and off the OS filesystem
+	discover func(path string, size int64) // OnDiscover, or nil
+	extract  *extractConfig                // nil = archives are not unpacked
+
+	dirLocks  sync.Map // destination dir -> *sync.Mutex
+	unpacking sync.Map // staging folders of archives being unpacked
+}
+
+// lockDir serializes picking a free name in dir and taking it, so two
+// workers never settle on the same " (n)" and overwrite each other.
+func (cfg *config) lockDir(dir string) func() {
+	mu, _ := cfg.dirLocks.LoadOrStore(dir, new(sync.Mutex))
+	mu.(*sync.Mutex).Lock()
+	return mu.(*sync.Mutex).Unlock
+}
+
+// apply runs a filesystem change through the write-ahead journal.
+func (cfg *config) apply(m Move, fn func() error) error {
+	if cfg.journal == nil {
+		return fn()
+	}
+	return cfg.journal.record(m, fn)
+}
+
+// discovered reports a queued job, and its sidecars, to OnDiscover.
+// Projects are reported with size -1: their size is only known once
+// they are placed.
+func (cfg *config) discovered(j job) {
+	if cfg.discover == nil {
+		return
+	}
+	for _, s := range append([]job{j}, j.sidecars...) {
+		size := s.info.Size()
+		if s.info.IsDir() {
+			size = -1
+		}
+		cfg.discover(s.srcPath, size)
+	}
+}
+
+// place puts src at dst: with the mover on the OS filesystem, by renaming
+// on any other FS (only ModeMove is allowed there), and in the overlay in
+// dry-run.
+func (cfg *config) place(src, dst string) error {
+	switch {
+	case cfg.sim != nil && cfg.mover.Mode() != ModeMove:
+		cfg.sim.link(src, dst)
+		return nil
+	case cfg.sim != nil || !onOS(cfg.fs):
+		return moveFile(cfg.fs, src, dst)
+	}
+	return cfg.mover.Place(src, dst)
+}
+
+// Move record for manifest/undo. Action is empty for a plain move; for
+// duplicates it names what was done and Dst is the kept copy (or, for
+// move-duplicate, where the duplicate went).
+type Move struct {
+	Src    string    `json:"src"`
+	Dst    string    `json:"dst"`
+	When   time.Time `json:"when"`
+	Action string    `json:"action,omitempty"`
+	Backup string    `json:"backup,omitempty"` // overwritten target, for Action "overwrite"; staging folder, for "extract"
+	Mode   string    `json:"mode,omitempty"`   // copy, symlink or hardlink; empty for a move
+	Group  string    `json:"group,omitempty"`  // primary's source path, for a file moved as part of a group
+
+	// Category, Size and Hash (SHA-256) describe the file as it was
+	// organized; undo uses them to filter and to detect later changes.
+	Category string `json:"category,omitempty"`
+	Size     int64  `json:"size,omitempty"`
+	Hash     string `json:"sha256,omitempty"`
+
+	seq int64 // journal sequence number, for marking it undone
+}
+
+// walkSource queues every eligible file under srcDir.
+// It stops early, without queuing anything else, once ctx is cancelled.
+func walkSource(ctx context.Context, srcDir string, cfg *config, jobs chan<- job, results chan<- result) {
+	groups := make(map[string]*dirGroups)
+	_ = cfg.fs.Walk(srcDir, func(path string, info os.FileInfo, err error) error {
+		if ctx.Err() != nil {
+			return filepath.SkipAll
+		}
+		if err != nil && path != srcDir && errors.Is(err, fs.ErrNotExist) {
+			return nil // moved meanwhile, e.g. as a sidecar
+		}
+		if err != nil {
+			results <- result{srcPath: path, err: err}
+			return nil
+		}
+		// Skip directories, never descending into our own manifests
+		// or anything .organizerignore / -exclude rules out
+		if info.IsDir() {
+			if path == srcDir {
+				return nil
+			}
+			if ownDir(info.Name()) || cfg.ignore.skipDir(path) {
+				return filepath.SkipDir
+			}
+			// Projects move as one unit and are never descended into;
+			// the filters judge them whole, not by the files inside
+			if isProject, queue := projectAt(cfg, path, info); isProject {
+				if queue && !skipProject(cfg, path, info) {
+					return send(ctx, cfg, jobs, job{srcPath: path, info: info}, filepath.SkipDir)
+				}
+				return filepath.SkipDir
+			}
+			if cfg.filter.skipDir(path) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if skipFile(cfg, path, info) {
+			return nil
+		}
+
+		// Sidecars are queued with their primary, not on their own
+		dir, name := filepath.Split(path)
+		g, ok := groups[dir]
+		if !ok {
+			g = sidecarGroupsIn(cfg, filepath.Clean(dir))
+			groups[dir] = g
+		}
+		if _, ok := g.primary[name]; ok {
+			return nil
+		}
+		return send(ctx, cfg, jobs, job{srcPath: path, info: info, sidecars: g.sidecarJobs(cfg.fs, filepath.Clean(dir), name)}, nil)
+	})
+}
+
+// send queues j unless ctx is cancelled first, in which case the walk is
+// ended; otherwise it returns next for the walk to continue with.
+func send(ctx context.Context, cfg *config, jobs chan<- job, j job, next error) error {
+	select {
+	case jobs <- j:
+		cfg.discovered(j)
+		return next
+	case <-ctx.Done():
+		return filepath.SkipAll
+	}
+}
+
+// projectAt reports whether dir is a project and, if so, whether it should
+// be queued: hidden projects (without -include-hidden) and ones already
+// under a category folder are left alone.
+func projectAt(cfg *config, dir string, info os.FileInfo) (isProject, queue bool) {
+	if !cfg.projects.isProject(cfg.fs, dir) {
+		return false, false
+	}
+	if !cfg.includeHidden && isHidden(info) {
+		return true, false
+	}
+	return true, !inCategorizedSubfolder(cfg, dir)
+}
+
+// skipFile holds the per-file filters shared by the walker and the watcher.
+func skipFile(cfg *config, path string, info os.FileInfo) bool {
+	// Optional: skip hidden files
+	if !cfg.includeHidden && isHidden(info) {
+		return true
+	}
+	// Include/exclude patterns and .organizerignore files
+	if cfg.ignore.skipFile(path) {
+		return true
+	}
+	// Depth, size and age limits
+	if cfg.filter.skipFile(path, info) {
+		return true
+	}
+	// Skip files already under a categorized subfolder of dst
+	// (prevents re-moving if src==dst)
+	return inCategorizedSubfolder(cfg, path)
+}
+
+// skipProject is skipFile for a project directory, which is judged as one
+// unit: -include patterns match its path, and the size and age limits
+// apply to the total size and newest mtime of its tree.
+func skipProject(cfg *config, dir string, info os.FileInfo) bool {
+	if cfg.ignore.skipProject(dir) {
+		return true
+	}
+	if cfg.filter.limitsSizeOrAge() {
+		size, newest := treeStamp(cfg.fs, dir)
+		info = treeInfo{info, size, newest}
+	}
+	return cfg.filter.skipFile(dir, info)
+}
+
+func worker(
+	ctx context.Context,
+	wg *sync.WaitGroup,
+	jobs <-chan job,
+	results chan<- result,
+	cfg *config,
+) {
+	defer wg.Done()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case j, ok := <-jobs:
+			if !ok || ctx.Err() != nil {
+				return
+			}
+			start := time.Now()
+			r := handleJob(j, cfg)
+			r.elapsed = time.Since(start)
+			if r.bytes == 0 && !j.info.IsDir() {
+				r.bytes = j.info.Size()
+			}
+			if r.info == nil {
+				r.info = j.info
+			}
+			results <- r
+			for _, s := range groupResults(j, r) {
+				results <- s
+			}
+			for _, a := range r.after {
+				if cfg.discover != nil {
+					cfg.discover(a.srcPath, a.bytes)
+				}
+				results <- a
+			}
+			if j.done != nil {
+				j.done()
+			}
+		}
+	}
+}
+
+func handleJob(j job, cfg *config) result {
+	if j.plan != nil {
+		return handlePlanned(j, cfg)
+	}
+	if j.info.IsDir() {
+		return handleProject(j, cfg)
+	}
+
+	if cfg.dedupeIdx != nil && j.info.Mode().IsRegular() {
+		e, isNew, err := cfg.dedupeIdx.claim(j.srcPath, j.info.Size())
+		if err != nil {
+			return result{srcPath: j.srcPath, err: err}
+		}
+		if !isNew {
+			return handleDuplicate(j, e.keptPath(), cfg.dedupe, cfg)
+		}
+		// Not placed after all (skipped, failed): it stays where it was
+		j.dup = e
+		defer e.settle(j.srcPath)
+	}
+	category, name := classify(cfg, j)
+
+	// Compute destination folder and filename from the layout template
+	ext := filepath.Ext(name)
+	vars := map[string]string{
+		"category": category,
+		"name":     strings.TrimSuffix(name, ext),
+		"ext":      ext,
+	}
+	if cfg.layout.needsDate {
+		dateLayoutVars(vars, fileDate(cfg.fs, j.srcPath, j.info, cfg.dateFrom))
+	}
+	if cfg.layout.needsExif {
+		x, _ := readExif(cfg.fs, j.srcPath)
+		exifLayoutVars(vars, x)
+	}
+	rel, err := cfg.layout.render(vars)
+	if err != nil {
+		return result{srcPath: j.srcPath, err: err}
+	}
+	return placeAt(j, filepath.Join(cfg.dstRoot, rel), category, cfg)
+}
+
+// classify picks a file's category and the name it is placed under,
+// which differs from its own only when sniffing fixes the extension.
+func classify(cfg *config, j job) (category, name string) {
+	name = j.info.Name()
+	if !cfg.sniff {
+		return cfg.classifier.Classify(name, j.info.Size()), name
+	}
+	classifyAs, name, fallback := sniffName(cfg.fs, j.srcPath, name, cfg.fixExt)
+	category = cfg.classifier.Classify(classifyAs, j.info.Size())
+	if category == "Other" && fallback != "" {
+		category = fallback
+	}
+	return category, name
+}
+
+// placeAt puts a classified file, and its sidecars, at dstPath, resolving
+// name conflicts on the way. Jobs from an applied plan start here.
+func placeAt(j job, dstPath, category string, cfg *config) result {
+	dryRun := cfg.dryRun
+	wanted := dstPath
+	dstDir := filepath.Dir(dstPath)
+	var err error
+
+	// If the source and destination are the same path, skip
+	if sameFile(j.srcPath, dstPath) {
+		return result{srcPath: j.srcPath, dstPath: dstPath, action: "skip"}
+	}
+
+	unlock := cfg.lockDir(dstDir)
+	defer func() { unlock() }()
+
+	// Ensure destination directory exists (in the overlay, in dry-run)
+	if err := cfg.fs.MkdirAll(dstDir, 0o755); err != nil {
+		return result{srcPath: j.srcPath, dstPath: dstPath, err: err}
+	}
+
+	// Resolve name conflicts according to -on-conflict. A group is renamed
+	// as a whole when any of its targets is taken. Dry runs see what was
+	// placed before them, so they report the names a real run would use.
+	overwrite := false
+	if !exists(cfg.fs, dstPath) && len(j.sidecars) > 0 && groupTaken(cfg.fs, j, dstPath) {
+		if dstPath, err = nextAvailableGroupName(cfg.fs, j, dstPath); err != nil {
+			return result{srcPath: j.srcPath, dstPath: dstPath, err: err}
+		}
+	} else if exists(cfg.fs, dstPath) {
+		decision, next, err := resolveConflict(cfg.fs, cfg.onConflict, j, dstPath)
+		if err != nil {
+			return result{srcPath: j.srcPath, dstPath: dstPath, err: err}
+		}
+		switch decision {
+		case decideSkip:
+			return result{srcPath: j.srcPath, dstPath: dstPath, action: "skip", note: "exists: " + dstPath}
+		case decideDuplicate:
+			policy := cfg.dedupe
+			if policy == "" {
+				policy = DedupeSkip
+			}
+			unlock()
+			unlock = func() {}
+			return handleDuplicate(j, dstPath, policy, cfg)
+		case decideOverwrite:
+			overwrite = true
+		default:
+			if len(j.sidecars) > 0 {
+				if next, err = nextAvailableGroupName(cfg.fs, j, dstPath); err != nil {
+					return result{srcPath: j.srcPath, dstPath: dstPath, err: err}
+				}
+			}
+			dstPath = next
+		}
+	}
+
+	// Move (or simulate)
+	r := result{srcPath: j.srcPath, dstPath: dstPath, action: "move", category: category}
+	if dstPath != wanted {
+		r.renamed = wanted
+	}
+	if len(j.sidecars) > 0 {
+		r.group = j.srcPath
+	}
+	m := Move{Src: j.srcPath, Dst: dstPath, Mode: manifestMode(cfg.mover.Mode()), Group: r.group, Category: category}
+	if err := fingerprint(&m, j, cfg); err != nil {
+		return result{srcPath: j.srcPath, dstPath: dstPath, err: err}
+	}
+	switch {
+	case overwrite && (dryRun || cfg.journal == nil):
+		// Nowhere to keep a backup; replace outright
+		err = cfg.place(j.srcPath, dstPath)
+		r.note = "replaced existing"
+	case overwrite:
+		backup, berr := backupPathFor(cfg, dstPath)
+		if berr != nil {
+			return result{srcPath: j.srcPath, dstPath: dstPath, err: berr}
+		}
+		m.Action, m.Backup = actionOverwrite, backup
+		err = cfg.apply(m, func() error {
+			return overwriteFile(cfg.mover, j.srcPath, dstPath, backup)
+		})
+		r.note = "replaced existing, backup " + backup
+	default:
+		err = cfg.apply(m, func() error {
+			return cfg.place(j.srcPath, dstPath)
+		})
+	}
+	if err != nil {
+		return result{srcPath: j.srcPath, dstPath: dstPath, err: err}
+	}
+	r.sidecars = placeSidecars(j, dstPath, category, overwrite, cfg)
+	if j.dup != nil {
+		j.dup.settle(dstPath)
+	}
+	if cfg.extract != nil && !j.extracted {
+		unlock()
+		unlock = func() {}
+		r.after = extractPlaced(cfg, dstPath, category)
+	}
+	return r
+}
+
+// Returns true if path is inside a destination folder the layout produces,
+// e.g. dstRoot/<any-known-category>/... for the default layout.
+func inCategorizedSubfolder(cfg *config, path string) bool {
+	absRoot, _ := filepath.Abs(cfg.dstRoot)
+	absPath, _ := filepath.Abs(path)
+
+	rel, err := filepath.Rel(absRoot, absPath)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return false
+	}
+
+	if rel == "." || rel == "" {
+		return false
+	}
+	if strings.Split(rel, string(filepath.Separator))[0] == duplicatesDir {
+		return true
+	}
+
+	return cfg.layout.matchesDir(rel, cfg.classifier)
+}
+
+// categorizedDir reports whether every file under dir is in a categorized
+// subfolder, so a walk has nothing to pick up there. That includes the
+// deepest folders the layout makes, not just the ones below them.
+func categorizedDir(cfg *config, dir string) bool {
+	return inCategorizedSubfolder(cfg, filepath.Join(dir, "_"))
+}
+
+func sameFile(a, b string) bool {
+	absA, _ := filepath.Abs(a)
+	absB, _ := filepath.Abs(b)
+	return absA == absB
+}
+
+func nextAvailableName(fsys FS, path string) (string, error) {
+	dir := filepath.Dir(path)
+	base := filepath.Base(path)
+	ext := filepath.Ext(base)
+	name := strings.TrimSuffix(base, ext)
+
+	for i := 1; i < 10_000; i++ {
+		candidate := filepath.Join(dir, fmt.Sprintf("%s (%d)%s", name, i, ext))
+		if !exists(fsys, candidate) {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("too many name conflicts for %q", path)
+}
+
+// moveFile attempts a fast rename; if crossing devices, it falls back to a
+// verified, metadata-preserving copy and removes src only once that succeeded.
+// Other filesystems than the OS have no devices to cross.
+func moveFile(fsys FS, src, dst string) error {
+	// try rename
+	err := fsys.Rename(src, dst)
+	if err == nil || !onOS(fsys) {
+		return err
+	}
+
+	// fallback: verified copy then remove
+	if fi, err := os.Lstat(src); err == nil && fi.IsDir() {
+		if err := copyTree(src, dst, copyVerified); err != nil {
+			return err
+		}
+		return os.RemoveAll(src)
+	}
+	if err := copyVerified(src, dst); err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer func(in *os.File) {
+		_ = in.Close()
+	}(in)
+
+	// Create with same perms as source when possible
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, info.Mode())
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = out.Close()
+	}()
+
+	if _, err := io.Copy(out, in); err != nil {
+		return err
+	}
+	return nil
+}
+
+// isHidden: on Unix, files starting with '.'; on Windows, this is a naive check.
+// (You can improve Windows detection using syscall attributes in a future iteration.)
+func isHidden(info os.FileInfo) bool {
+	name := info.Name()
+	return strings.HasPrefix(name, ".")
+}
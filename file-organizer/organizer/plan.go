@@ -0,0 +1,256 @@
+package organizer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// planVersion is bumped when the plan format changes incompatibly.
+const planVersion = 1
+
+// errPlanStale marks a planned file that changed after the plan was made.
+var errPlanStale = errors.New("changed since plan")
+
+// Plan is what a dry run records (Summary.Plan) and WithPlan carries out.
+// It is meant to be reviewed and edited: entries can be removed,
+// retargeted by changing dst, or switched off with "action": "skip".
+type Plan struct {
+	Version    int         `json:"version"`
+	Created    time.Time   `json:"created"`
+	Src        string      `json:"src"`
+	Dest       string      `json:"dest"`
+	Mode       string      `json:"mode"`
+	OnConflict string      `json:"on_conflict"`
+	Entries    []PlanEntry `json:"entries"`
+}
+
+// PlanEntry is one planned change. Size and ModTime are what the source
+// looked like when planned; apply refuses to touch it if they differ.
+type PlanEntry struct {
+	Src      string    `json:"src"`
+	Dst      string    `json:"dst"`
+	Action   string    `json:"action"` // "move" (placed per mode), "skip", or a duplicate action
+	Category string    `json:"category,omitempty"`
+	DupOf    string    `json:"dup_of,omitempty"`
+	Group    string    `json:"group,omitempty"` // primary's src for sidecars and their primary
+	Dir      bool      `json:"dir,omitempty"`   // a project directory
+	Size     int64     `json:"size"`
+	ModTime  time.Time `json:"mtime"`
+}
+
+// add records a dry-run result. Only changes are planned; skips and errors
+// are left to the console output.
+func (p *Plan) add(r result) {
+	if r.err != nil || r.info == nil || (r.action != "move" && !IsDuplicateAction(r.action)) {
+		return
+	}
+	e := PlanEntry{
+		Src:      absPath(r.srcPath),
+		Dst:      absPath(r.dstPath),
+		Action:   r.action,
+		Category: r.category,
+		Dir:      r.info.IsDir(),
+		Size:     r.info.Size(),
+		ModTime:  r.info.ModTime(),
+	}
+	if r.dupOf != "" {
+		e.DupOf = absPath(r.dupOf)
+	}
+	if r.group != "" {
+		e.Group = absPath(r.group)
+	}
+	if e.Dir {
+		e.Size = 0 // directory sizes mean nothing across filesystems
+	}
+	p.Entries = append(p.Entries, e)
+}
+
+func absPath(p string) string {
+	if abs, err := filepath.Abs(p); err == nil {
+		return abs
+	}
+	return p
+}
+
+// Write saves the plan atomically, entries sorted by source for review.
+// Duplicates point at where their kept copy is planned to end up, since
+// that is where it will be by the time they are handled.
+func (p *Plan) Write(path string) error {
+	sort.SliceStable(p.Entries, func(a, b int) bool { return p.Entries[a].Src < p.Entries[b].Src })
+	planned := make(map[string]string)
+	for _, e := range p.Entries {
+		if e.Action == "move" {
+			planned[e.Src] = e.Dst
+		}
+	}
+	for i, e := range p.Entries {
+		if dst, ok := planned[e.DupOf]; ok && IsDuplicateAction(e.Action) {
+			p.Entries[i].DupOf = dst
+			if e.Action == actionSkipDuplicate {
+				p.Entries[i].Dst = dst
+			}
+		}
+	}
+	if p.Entries == nil {
+		p.Entries = []PlanEntry{}
+	}
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// LoadPlan reads and validates a plan saved with Write.
+func LoadPlan(path string) (*Plan, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var p Plan
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("plan %q: %w", path, err)
+	}
+	if p.Version != planVersion {
+		return nil, fmt.Errorf("plan %q: unsupported version %d", path, p.Version)
+	}
+	for i, e := range p.Entries {
+		switch {
+		case e.Src == "" || (e.Dst == "" && e.Action != "skip" && e.Action != actionSkipDuplicate):
+			return nil, fmt.Errorf("plan %q: entry %d: src and dst are required", path, i+1)
+		case e.Action == "move", e.Action == "skip":
+		case IsDuplicateAction(e.Action):
+			if e.DupOf == "" {
+				return nil, fmt.Errorf("plan %q: entry %d: %s needs dup_of", path, i+1, e.Action)
+			}
+		default:
+			return nil, fmt.Errorf("plan %q: entry %d: unknown action %q", path, i+1, e.Action)
+		}
+	}
+	return &p, nil
+}
+
+// checkPlanned stats a planned source and makes sure it is still what was
+// planned.
+func checkPlanned(fsys FS, e *PlanEntry) (os.FileInfo, error) {
+	info, err := fsys.Lstat(e.Src)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() != e.Dir || (!e.Dir && info.Size() != e.Size) || !info.ModTime().Equal(e.ModTime) {
+		return nil, fmt.Errorf("%s: %w", e.Src, errPlanStale)
+	}
+	return info, nil
+}
+
+// queuePlan is walkSource for apply: it validates each entry and queues
+// it, with sidecars riding along with their primary as when planned.
+// Duplicates are queued last, once every placement has finished, so the
+// kept copies they are checked against are in place.
+func queuePlan(ctx context.Context, cfg *config, p *Plan, jobs chan<- job, results chan<- result) {
+	var placing sync.WaitGroup
+	var dupes []job
+	planned := make(map[string]bool)
+	for _, e := range p.Entries {
+		if e.Action != "skip" {
+			planned[e.Src] = true
+		}
+	}
+	sidecars := make(map[string][]*PlanEntry)
+	for i := range p.Entries {
+		e := &p.Entries[i]
+		if e.Group != "" && e.Group != e.Src && planned[e.Group] {
+			sidecars[e.Group] = append(sidecars[e.Group], e)
+		}
+	}
+
+	for i := range p.Entries {
+		e := &p.Entries[i]
+		if e.Group != "" && e.Group != e.Src && planned[e.Group] {
+			continue // queued with its primary
+		}
+		if e.Action == "skip" {
+			results <- result{srcPath: e.Src, action: "skip", note: "skipped in plan"}
+			continue
+		}
+		info, err := checkPlanned(cfg.fs, e)
+		if err != nil {
+			results <- result{srcPath: e.Src, dstPath: e.Dst, err: err}
+			for _, s := range sidecars[e.Src] {
+				results <- result{srcPath: s.Src, action: "skip", note: "stays with " + filepath.Base(e.Src)}
+			}
+			continue
+		}
+		j := job{srcPath: e.Src, info: info, plan: e}
+		for _, s := range sidecars[e.Src] {
+			if s.Action == "skip" {
+				results <- result{srcPath: s.Src, action: "skip", note: "skipped in plan"}
+				continue
+			}
+			sinfo, err := checkPlanned(cfg.fs, s)
+			if err != nil {
+				results <- result{srcPath: s.Src, dstPath: s.Dst, err: err}
+				continue
+			}
+			j.sidecars = append(j.sidecars, job{srcPath: s.Src, info: sinfo, plan: s})
+		}
+		if IsDuplicateAction(e.Action) {
+			dupes = append(dupes, j)
+			continue
+		}
+		placing.Add(1)
+		j.done = placing.Done
+		if send(ctx, cfg, jobs, j, nil) != nil {
+			return
+		}
+	}
+
+	placed := make(chan struct{})
+	go func() {
+		placing.Wait()
+		close(placed)
+	}()
+	select {
+	case <-placed:
+	case <-ctx.Done():
+		return
+	}
+	for _, j := range dupes {
+		if send(ctx, cfg, jobs, j, nil) != nil {
+			return
+		}
+	}
+}
+
+// handlePlanned carries out one planned entry.
+func handlePlanned(j job, cfg *config) result {
+	e := j.plan
+	if IsDuplicateAction(e.Action) {
+		// Only act on a duplicate that still is one.
+		if e.Action != actionSkipDuplicate {
+			same, err := sameContent(cfg.fs, j.srcPath, e.DupOf)
+			if err != nil {
+				return result{srcPath: j.srcPath, dstPath: e.DupOf, err: err}
+			}
+			if !same {
+				return result{srcPath: j.srcPath, dstPath: e.DupOf, err: fmt.Errorf("no longer a duplicate of %s: %w", e.DupOf, errPlanStale)}
+			}
+		}
+		return handleDuplicate(j, e.DupOf, dedupePolicyFor(e.Action), cfg)
+	}
+	if j.info.IsDir() {
+		return handleProject(j, cfg)
+	}
+	return placeAt(j, e.Dst, e.Category, cfg)
+}
@@ -0,0 +1,60 @@
+package organizer
+
+import (
+	"errors"
+	"maps"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPlanApply(t *testing.T) {
+	files := map[string]string{"src/a.pdf": "a", "src/b.jpg": "b", "src/c.txt": "c", "dst/Docs/c.txt": "taken"}
+	m := memTree(t, files)
+	sum := runMem(t, m, WithDryRun(true))
+	if got := memFiles(t, m); !maps.Equal(got, files) {
+		t.Fatalf("dry run changed the tree: %v", got)
+	}
+	if sum.Plan == nil || len(sum.Plan.Entries) != 3 {
+		t.Fatalf("plan = %+v, want 3 entries", sum.Plan)
+	}
+
+	// Retarget one entry and switch another off, as a reviewer would
+	for i := range sum.Plan.Entries {
+		e := &sum.Plan.Entries[i]
+		switch filepath.Base(e.Src) {
+		case "b.jpg":
+			e.Dst = "/dst/Images/Holiday/b.jpg"
+		case "a.pdf":
+			e.Action = "skip"
+		}
+	}
+	applied := runMem(t, m, WithPlan(sum.Plan))
+	if applied.Failed > 0 || applied.Placed != 2 {
+		t.Fatalf("applied: placed %d, failed %d; want 2 placed", applied.Placed, applied.Failed)
+	}
+	want := map[string]string{"src/a.pdf": "a", "dst/Images/Holiday/b.jpg": "b", "dst/Docs/c.txt": "taken", "dst/Docs/c (1).txt": "c"}
+	if got := memFiles(t, m); !maps.Equal(got, want) {
+		t.Errorf("got  %v\nwant %v", got, want)
+	}
+}
+
+func TestPlanApplyRefusesChangedFiles(t *testing.T) {
+	m := memTree(t, map[string]string{"src/a.txt": "a"})
+	sum := runMem(t, m, WithDryRun(true))
+	if err := m.WriteFile("/src/a.txt", []byte("edited"), 0o644, testTime.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	var got error
+	runMem(t, m, WithPlan(sum.Plan), OnEvent(func(e Event) {
+		if e.Err != nil {
+			got = e.Err
+		}
+	}))
+	if !errors.Is(got, errPlanStale) {
+		t.Errorf("error = %v, want %v", got, errPlanStale)
+	}
+	if !exists(m, "/src/a.txt") {
+		t.Error("the changed file was moved")
+	}
+}
@@ -0,0 +1,236 @@
+package organizer
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// projectsCategory is where whole project directories are placed.
+const projectsCategory = "Projects"
+
+// actionProject is the manifest action for a directory placed as one unit.
+const actionProject = "project"
+
+// defaultProjectMarkers make a directory a project when any entry directly
+// inside it matches one of them. Patterns use filepath.Match syntax.
+var defaultProjectMarkers = []string{".git", "go.mod", "package.json", "*.xcodeproj"}
+
+// projectDetector recognizes project directories by their marker entries.
+type projectDetector struct {
+	markers []string
+}
+
+// newProjectDetector combines the default markers with --project-marker
+// values. It returns nil (detection off) when disabled.
+func newProjectDetector(disabled bool, extra []string) (*projectDetector, error) {
+	if disabled {
+		return nil, nil
+	}
+	markers := append(append([]string(nil), defaultProjectMarkers...), extra...)
+	for _, m := range markers {
+		if _, err := filepath.Match(m, ""); err != nil {
+			return nil, fmt.Errorf("invalid project marker %q: %w", m, err)
+		}
+	}
+	return &projectDetector{markers: markers}, nil
+}
+
+// isProject reports whether dir directly contains a marker.
+func (d *projectDetector) isProject(fsys FS, dir string) bool {
+	if d == nil {
+		return false
+	}
+	entries, err := fsys.ReadDir(dir)
+	if err != nil {
+		return false
+	}
+	for _, e := range entries {
+		for _, m := range d.markers {
+			if ok, _ := filepath.Match(m, e.Name()); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// handleProject places a whole project directory under Projects. Name
+// conflicts are renamed unless the policy is skip: overwriting or comparing
+// entire trees is never done implicitly.
+func handleProject(j job, cfg *config) result {
+	dstPath, err := projectDst(j, cfg)
+	if err != nil {
+		return result{srcPath: j.srcPath, err: err}
+	}
+	if sameFile(j.srcPath, dstPath) {
+		return result{srcPath: j.srcPath, dstPath: dstPath, action: "skip"}
+	}
+	size, _ := treeStamp(cfg.fs, j.srcPath)
+	defer cfg.lockDir(filepath.Dir(dstPath))()
+	if err := cfg.fs.MkdirAll(filepath.Dir(dstPath), 0o755); err != nil {
+		return result{srcPath: j.srcPath, dstPath: dstPath, err: err}
+	}
+	renamed := ""
+	if _, err := cfg.fs.Lstat(dstPath); err == nil {
+		if cfg.onConflict == ConflictSkip {
+			return result{srcPath: j.srcPath, dstPath: dstPath, action: "skip", note: "exists: " + dstPath}
+		}
+		renamed = dstPath
+		if dstPath, err = nextAvailableName(cfg.fs, dstPath); err != nil {
+			return result{srcPath: j.srcPath, dstPath: dstPath, err: err}
+		}
+	}
+
+	m := Move{Src: j.srcPath, Dst: dstPath, Action: actionProject, Mode: manifestMode(cfg.mover.Mode()), Category: projectsCategory}
+	if cfg.journal != nil && (m.Mode == ModeCopy || m.Mode == ModeHardlink) {
+		// Undo deletes the copied tree, so it must know if it was edited
+		if m.Hash, m.Size, err = treeDigest(j.srcPath); err != nil {
+			return result{srcPath: j.srcPath, dstPath: dstPath, err: err}
+		}
+	}
+	err = cfg.apply(m, func() error {
+		return cfg.place(j.srcPath, dstPath)
+	})
+	if err != nil {
+		return result{srcPath: j.srcPath, dstPath: dstPath, err: err}
+	}
+	return result{srcPath: j.srcPath, dstPath: dstPath, action: "move", note: "project", bytes: size, category: projectsCategory, renamed: renamed}
+}
+
+// projectDst renders the layout for a project directory, or takes the
+// destination from the plan being applied.
+func projectDst(j job, cfg *config) (string, error) {
+	if j.plan != nil {
+		return j.plan.Dst, nil
+	}
+	vars := map[string]string{
+		"category": projectsCategory,
+		"name":     j.info.Name(),
+		"ext":      "",
+	}
+	if cfg.layout.needsDate {
+		dateLayoutVars(vars, fileDate(cfg.fs, j.srcPath, j.info, cfg.dateFrom))
+	}
+	if cfg.layout.needsExif {
+		exifLayoutVars(vars, nil)
+	}
+	rel, err := cfg.layout.render(vars)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(cfg.dstRoot, rel), nil
+}
+
+// placeDir is placeFile for a whole directory. Copies and hard-linked
+// mirrors are built in a temp directory and renamed into place, so dst
+// either holds the complete tree or does not exist.
+func placeDir(mode, src, dst string) error {
+	switch mode {
+	case ModeCopy:
+		return copyTree(src, dst, copyVerified)
+	case ModeHardlink:
+		return copyTree(src, dst, os.Link)
+	case ModeSymlink:
+		return placeFile(mode, src, dst)
+	}
+	return moveFile(OS, src, dst)
+}
+
+// copyTree recreates src at dst, placing each regular file with place and
+// keeping symlinks as symlinks. Directory modes and times are carried over
+// once their contents are in.
+func copyTree(src, dst string, place func(src, dst string) error) error {
+	tmp, err := os.MkdirTemp(filepath.Dir(dst), stagingPattern)
+	if err != nil {
+		return err
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			_ = os.RemoveAll(tmp)
+		}
+	}()
+
+	type dirTimes struct {
+		path string
+		info os.FileInfo
+	}
+	var dirs []dirTimes
+	err = filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(tmp, rel)
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case d.IsDir():
+			if rel != "." {
+				if err := os.Mkdir(target, 0o755); err != nil {
+					return err
+				}
+			}
+			dirs = append(dirs, dirTimes{target, info})
+			return nil
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case info.Mode().IsRegular():
+			return place(path, target)
+		}
+		return nil // sockets, devices and pipes are not carried over
+	})
+	if err != nil {
+		return err
+	}
+	// Deepest first, so setting a child's times doesn't bump its parent.
+	for i := len(dirs) - 1; i >= 0; i-- {
+		_ = os.Chmod(dirs[i].path, dirs[i].info.Mode().Perm())
+		_ = os.Chtimes(dirs[i].path, time.Now(), dirs[i].info.ModTime())
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		return err
+	}
+	committed = true
+	syncDir(filepath.Dir(dst))
+	return nil
+}
+
+// isPlacedDir is isPlacedBy for a project directory. A copy or mirror only
+// appears at dst once complete, so it is enough that both sides are still
+// directories; symlinks are checked like files. Whether the tree was
+// edited since is verifyUnchanged's job.
+func isPlacedDir(mode, src, dst string) (bool, error) {
+	if mode == ModeSymlink {
+		return isPlacedBy(mode, src, dst)
+	}
+	if fi, err := os.Stat(src); err != nil || !fi.IsDir() {
+		return false, fmt.Errorf("original %s is gone; keeping %s", src, mode)
+	}
+	fi, err := os.Lstat(dst)
+	if err != nil {
+		return false, err
+	}
+	return fi.IsDir(), nil
+}
+
+// removePlaced deletes what undo or recovery decided to drop: a whole
+// tree for project copies, a single entry otherwise.
+func removePlaced(m Move) error {
+	if m.Action == actionProject && m.Mode != ModeSymlink {
+		return os.RemoveAll(m.Dst)
+	}
+	return os.Remove(m.Dst)
+}
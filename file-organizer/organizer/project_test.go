@@ -0,0 +1,83 @@
+package organizer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestProjectFilters(t *testing.T) {
+	// proj's files are each smaller than 15 bytes but 20 together, and
+	// its newest one is two days newer than everything else; deep/er/proj
+	// is one 8-byte file
+	day := 24 * time.Hour
+	tests := []struct {
+		name          string
+		opts          []Option
+		project, deep bool // proj/ and deep/er/proj/ are moved
+		file          bool // a.txt is moved
+	}{
+		{"no filters", nil, true, true, true},
+		{"include matching the project", []Option{WithIncludes("proj")}, true, true, false},
+		{"include matching the project as a directory", []Option{WithIncludes("proj/")}, true, true, false},
+		{"anchored include", []Option{WithIncludes("/proj")}, true, false, false},
+		{"include matching its files only", []Option{WithIncludes("*.txt")}, false, false, true},
+		{"include matching inside the project", []Option{WithIncludes("*.go")}, false, false, false},
+		{"exclude", []Option{WithExcludes("/proj/")}, false, true, true},
+		{"min size below the total", []Option{WithSizeRange(15, 0)}, true, false, false},
+		{"min size above the total", []Option{WithSizeRange(25, 0)}, false, false, false},
+		{"max size above the total", []Option{WithSizeRange(0, 25)}, true, true, true},
+		{"max size below the total", []Option{WithSizeRange(0, 15)}, false, true, true},
+		{"newer than, by its newest file", []Option{WithModTimeRange(testTime.Add(day), time.Time{})}, true, false, false},
+		{"newer than its newest file", []Option{WithModTimeRange(testTime.Add(3*day), time.Time{})}, false, false, false},
+		{"older than its newest file", []Option{WithModTimeRange(time.Time{}, testTime.Add(day))}, false, true, true},
+		{"older than everything", []Option{WithModTimeRange(time.Time{}, testTime.Add(3*day))}, true, true, true},
+		{"max depth", []Option{WithMaxDepth(0)}, true, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := memTree(t, map[string]string{"src/a.txt": "a", "src/proj/go.mod": "module p", "src/deep/er/proj/go.mod": "module q"})
+			if err := m.WriteFile("/src/proj/main.go", []byte("package main"), 0o644, testTime.Add(2*day)); err != nil {
+				t.Fatal(err)
+			}
+			sum := runMem(t, m, tt.opts...)
+			if sum.Failed > 0 {
+				t.Fatalf("%d file(s) failed", sum.Failed)
+			}
+			for path, want := range map[string]bool{"/src/proj": tt.project, "/src/deep/er/proj": tt.deep, "/src/a.txt": tt.file} {
+				if got := !exists(m, path); got != want {
+					t.Errorf("%s moved = %v, want %v", path, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestProjectSinceLastRun(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	writeTree(t, src, map[string]string{"a.txt": "a"})
+	organize(t, src, dst)
+
+	// One project is entirely older than the last run; the other has one
+	// file edited since
+	past := time.Now().Add(-48 * time.Hour)
+	writeTree(t, src, map[string]string{"old/go.mod": "module old", "old/main.go": "package main", "edited/go.mod": "module edited", "edited/main.go": "package main"})
+	for _, p := range []string{"old", "old/go.mod", "old/main.go", "edited", "edited/go.mod"} {
+		if err := os.Chtimes(filepath.Join(src, p), past, past); err != nil {
+			t.Fatal(err)
+		}
+	}
+	future := time.Now().Add(time.Hour)
+	if err := os.Chtimes(filepath.Join(src, "edited/main.go"), future, future); err != nil {
+		t.Fatal(err)
+	}
+
+	organize(t, src, dst, WithSinceLastRun())
+	if !exists(OS, filepath.Join(src, "old")) {
+		t.Error("a project unchanged since the last run was moved")
+	}
+	if exists(OS, filepath.Join(src, "edited")) {
+		t.Error("a project with a file edited since the last run was not moved")
+	}
+}
@@ -0,0 +1,237 @@
+package organizer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ActionExpire is the Event action for a file a retention rule moved to
+// the trash. Src is where it was, Dst where it is in the trash.
+const ActionExpire = "expire"
+
+// actionExpire is the journal action for an expiry; undo moves Dst back
+// to Src.
+const actionExpire = ActionExpire
+
+// RetentionTrash is the only retention action: expired files go to the
+// trash under the destination root, never straight to deletion.
+const RetentionTrash = "trash"
+
+// RetentionRule expires the files of a category once they are older than
+// an age, by modification time. In a rules file:
+//
+//	retention:
+//	  - category: Archives
+//	    older_than: 30d
+//	    action: trash
+type RetentionRule struct {
+	Category  string `json:"category" yaml:"category" toml:"category"`
+	OlderThan string `json:"older_than" yaml:"older_than" toml:"older_than"` // e.g. 30d, 2w, 12h
+	Action    string `json:"action" yaml:"action" toml:"action"`             // "trash" (the default)
+
+	age time.Duration
+}
+
+var retentionSyntax = regexp.MustCompile(`(?i)^\s*(\S+)\s+older\s+than\s+(\S+)\s*(?:->\s*(\S+)\s*)?$`)
+
+// ParseRetentionRule reads the short form of a rule:
+// "Archives older than 30d -> trash" (the action may be left out).
+func ParseRetentionRule(s string) (RetentionRule, error) {
+	m := retentionSyntax.FindStringSubmatch(s)
+	if m == nil {
+		return RetentionRule{}, fmt.Errorf("invalid retention rule %q (want e.g. \"Archives older than 30d -> trash\")", s)
+	}
+	r := RetentionRule{Category: m[1], OlderThan: m[2], Action: strings.ToLower(m[3])}
+	if err := r.compile(); err != nil {
+		return RetentionRule{}, fmt.Errorf("retention rule %q: %w", s, err)
+	}
+	return r, nil
+}
+
+func (r *RetentionRule) compile() error {
+	if r.Category == "" {
+		return fmt.Errorf("missing category")
+	}
+	if strings.ContainsAny(r.Category, `/\`) || r.Category == "." || r.Category == ".." {
+		return fmt.Errorf("category %q must be a plain folder name", r.Category)
+	}
+	if r.Category == projectsCategory {
+		return fmt.Errorf("projects can't expire")
+	}
+	age, err := parseAge(r.OlderThan)
+	if err != nil || age <= 0 {
+		return fmt.Errorf("invalid age %q", r.OlderThan)
+	}
+	r.age = age
+	if r.Action == "" {
+		r.Action = RetentionTrash
+	}
+	if r.Action != RetentionTrash {
+		return fmt.Errorf("invalid action %q (want trash)", r.Action)
+	}
+	return nil
+}
+
+// String is the rule in its short form.
+func (r RetentionRule) String() string {
+	return fmt.Sprintf("%s older than %s -> %s", r.Category, r.OlderThan, r.Action)
+}
+
+// WithRetention expires organized files by rules, after the rules file's
+// own. Expiry runs once a run has placed everything; it is skipped when
+// the run is interrupted.
+func WithRetention(rules ...RetentionRule) Option {
+	return func(o *Organizer) error {
+		for _, r := range rules {
+			if err := r.compile(); err != nil {
+				return fmt.Errorf("retention rule %q: %w", r.String(), err)
+			}
+			o.retention = append(o.retention, r)
+		}
+		return nil
+	}
+}
+
+// expire moves regular files older than their category's rule to the
+// trash, reporting each one to emit. Files are found by the category the
+// layout filed them under, wherever in the path that is; the first rule
+// for its category that a file is old enough for expires it. Category
+// folders the layout doesn't produce (say, from before the layout was
+// changed) are reported to warn, as nothing in them can expire.
+func expire(ctx context.Context, cfg *config, rules []RetentionRule, now time.Time, emit func(result), warn func(format string, a ...any)) {
+	type candidate struct {
+		path string
+		rule RetentionRule
+	}
+	var expired []candidate
+	_ = walkFS(cfg.fs, cfg.dstRoot, func(path string, info os.FileInfo, err error) error {
+		if ctx.Err() != nil {
+			return filepath.SkipAll
+		}
+		if err != nil || path == cfg.dstRoot {
+			return nil
+		}
+		rel, err := filepath.Rel(cfg.dstRoot, path)
+		if err != nil {
+			return nil
+		}
+		if info.IsDir() {
+			if ownDir(info.Name()) || !cfg.layout.mayHold(rel, cfg.classifier) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() || (!cfg.includeHidden && isHidden(info)) {
+			return nil
+		}
+		category, ok := cfg.layout.categoryOf(rel, cfg.classifier)
+		if !ok {
+			return nil
+		}
+		for _, rule := range rules {
+			if rule.Category == category && info.ModTime().Before(now.Add(-rule.age)) {
+				expired = append(expired, candidate{path, rule})
+				break
+			}
+		}
+		return nil
+	})
+
+	warned := make(map[string]bool)
+	for _, rule := range rules {
+		dir := filepath.Join(cfg.dstRoot, rule.Category)
+		if warned[rule.Category] || cfg.layout.mayHold(rule.Category, cfg.classifier) {
+			continue
+		}
+		if info, err := cfg.fs.Stat(dir); err == nil && info.IsDir() {
+			warn("WARN   retention rule %q: layout %q doesn't put files in %s; nothing there expires", rule.String(), cfg.layout.tmpl, dir)
+			warned[rule.Category] = true
+		}
+	}
+
+	for _, c := range expired {
+		if ctx.Err() != nil {
+			return
+		}
+		r := trashFile(cfg, c.path, actionExpire, c.rule.Category, c.rule.String(), now)
+		if cfg.discover != nil {
+			cfg.discover(c.path, r.bytes)
+		}
+		emit(r)
+	}
+}
+
+// trashFile moves one file to the trash, with its metadata beside it,
+// journaled as action (actionExpire or actionTrash) so undo can put it
+// back. reason says why, e.g. the retention rule.
+func trashFile(cfg *config, path, action, category, reason string, now time.Time) result {
+	start := time.Now()
+	r := result{srcPath: path, action: action, category: category, note: reason}
+	info, err := cfg.fs.Lstat(path)
+	if err != nil {
+		r.err = err
+		return r
+	}
+	r.bytes = info.Size()
+
+	files, _ := trashDirs(cfg.dstRoot)
+	if err := cfg.fs.MkdirAll(files, 0o755); err != nil {
+		r.err = err
+		return r
+	}
+	// Archives of the same name from different folders may be trashed
+	// at once; the name stays locked until the file and its info are in
+	unlock := cfg.lockDir(files)
+	dst := filepath.Join(files, filepath.Base(path))
+	if exists(cfg.fs, dst) {
+		if dst, err = nextAvailableName(cfg.fs, dst); err != nil {
+			unlock()
+			r.err = err
+			return r
+		}
+	}
+	r.dstPath = dst
+
+	item := TrashItem{Path: absPath(path), Trashed: now, Category: category, Size: info.Size(), ModTime: info.ModTime(), Reason: reason}
+	r.err = cfg.apply(Move{Src: path, Dst: dst, When: now, Action: action, Category: category, Size: info.Size()}, func() error {
+		if cfg.sim != nil {
+			return moveFile(cfg.fs, path, dst)
+		}
+		if cfg.journal != nil {
+			// Named for good now that the intent is written
+			item.Manifest = cfg.journal.path
+		}
+		infoPath := trashInfoPath(dst)
+		if err := writeTrashInfo(infoPath, item); err != nil {
+			return err
+		}
+		if err := moveFile(cfg.fs, path, dst); err != nil {
+			_ = os.Remove(infoPath)
+			return err
+		}
+		return nil
+	})
+	unlock()
+	if r.err == nil && cfg.sim == nil {
+		pruneEmptyParents(filepath.Dir(path), cfg.dstRoot)
+	}
+	r.elapsed = time.Since(start)
+	return r
+}
+
+func writeTrashInfo(path string, item TrashItem) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(item, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
@@ -0,0 +1,88 @@
+package organizer
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRetentionRule(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string // "" = invalid
+		wantAge time.Duration
+	}{
+		{"Archives older than 30d -> trash", "Archives older than 30d -> trash", 30 * 24 * time.Hour},
+		{"Archives older than 2w", "Archives older than 2w -> trash", 14 * 24 * time.Hour},
+		{"  Images OLDER THAN 12h ->   TRASH ", "Images older than 12h -> trash", 12 * time.Hour},
+		{"Archives older than 30d -> delete", "", 0},
+		{"Projects older than 30d", "", 0},
+		{"Archives/Old older than 30d", "", 0},
+		{"Archives older than soon", "", 0},
+		{"Archives newer than 30d", "", 0},
+	}
+	for _, tt := range tests {
+		r, err := ParseRetentionRule(tt.in)
+		switch {
+		case tt.want == "" && err == nil:
+			t.Errorf("%q: parsed as %q, want an error", tt.in, r.String())
+		case tt.want != "" && (err != nil || r.String() != tt.want || r.age != tt.wantAge):
+			t.Errorf("%q: got %q (%s), %v; want %q (%s)", tt.in, r.String(), r.age, err, tt.want, tt.wantAge)
+		}
+	}
+}
+
+func TestRetentionFollowsLayout(t *testing.T) {
+	old := time.Now().AddDate(0, 0, -60)
+	tests := []struct {
+		layout  string
+		old     string // expires
+		recent  string // stays
+		other   string // another category; stays
+		warning bool
+	}{
+		{DefaultLayout, "Archives/a.zip", "Archives/b.zip", "Docs/c.pdf", false},
+		{"{category}/{year}/{name}{ext}", "Archives/2020/a.zip", "Archives/2024/b.zip", "Docs/2020/c.pdf", false},
+		{"{year}/{category}/{name}{ext}", "2020/Archives/a.zip", "2024/Archives/b.zip", "2020/Docs/c.pdf", true},
+		{"{year}/{category}-{name}{ext}", "2020/Archives-a.zip", "2024/Archives-b.zip", "2020/Docs-c.pdf", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.layout, func(t *testing.T) {
+			src, dst := t.TempDir(), t.TempDir()
+			writeTree(t, dst, map[string]string{tt.old: "a", tt.recent: "b", tt.other: "c"})
+			for _, p := range []string{tt.old, tt.other} {
+				if err := os.Chtimes(filepath.Join(dst, p), old, old); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.warning {
+				// Left over from the default layout: not where Archives go now
+				writeTree(t, dst, map[string]string{"Archives/stale.zip": "s"})
+			}
+			rule, err := ParseRetentionRule("Archives older than 30d")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var log bytes.Buffer
+			sum := organize(t, src, dst, WithLayout(tt.layout), WithRetention(rule), WithLog(&log))
+			if sum.Expired != 1 {
+				t.Fatalf("expired %d file(s), want 1", sum.Expired)
+			}
+			files, _ := trashDirs(dst)
+			if !exists(OS, filepath.Join(files, filepath.Base(tt.old))) {
+				t.Errorf("%s is not in the trash", tt.old)
+			}
+			for _, p := range []string{tt.recent, tt.other} {
+				if !exists(OS, filepath.Join(dst, p)) {
+					t.Errorf("%s was expired", p)
+				}
+			}
+			if got := strings.Contains(log.String(), "WARN"); got != tt.warning {
+				t.Errorf("warning = %v, want %v; log: %q", got, tt.warning, log.String())
+			}
+		})
+	}
+}
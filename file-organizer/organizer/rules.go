@@ -0,0 +1,293 @@
+package organizer
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// Simple extension -> category mapping.
+// You can expand this over time; unknowns fall into "Other".
+// Rules loaded with --rules take precedence; this map is the fallback.
+var extToCategory = map[string]string{
+	// Images
+	".jpg": "Images", ".jpeg": "Images", ".png": "Images", ".gif": "Images",
+	".webp": "Images", ".bmp": "Images", ".tiff": "Images", ".heic": "Images",
+	".cr2": "Images", ".cr3": "Images", ".nef": "Images", ".arw": "Images",
+	".dng": "Images", ".raf": "Images", ".orf": "Images", ".rw2": "Images",
+
+	// Video
+	".mp4": "Video", ".mov": "Video", ".mkv": "Video", ".avi": "Video",
+	".wmv": "Video", ".flv": "Video", ".webm": "Video",
+
+	// Audio
+	".mp3": "Audio", ".wav": "Audio", ".aac": "Audio", ".flac": "Audio",
+	".m4a": "Audio", ".ogg": "Audio",
+
+	// Docs
+	".pdf": "Docs", ".doc": "Docs", ".docx": "Docs", ".xls": "Docs",
+	".xlsx": "Docs", ".ppt": "Docs", ".pptx": "Docs",
+	".txt": "Docs", ".rtf": "Docs", ".md": "Docs", ".csv": "Docs",
+
+	// Archives
+	".zip": "Archives", ".rar": "Archives", ".7z": "Archives", ".gz": "Archives",
+	".tar": "Archives",
+
+	// Code
+	".go": "Code", ".cs": "Code", ".js": "Code", ".ts": "Code", ".jsx": "Code",
+	".tsx": "Code", ".py": "Code", ".java": "Code", ".rb": "Code",
+	".php": "Code", ".c": "Code", ".cpp": "Code", ".h": "Code", ".hpp": "Code",
+}
+
+// Classifier picks the category folder for a file from its base name and
+// size. Categories lists every folder it can produce, so already-organized
+// folders are recognized and emptied ones can be cleaned up after undo.
+type Classifier interface {
+	Classify(name string, size int64) string
+	Categories() []string
+}
+
+func isCategory(c Classifier, name string) bool {
+	for _, cat := range c.Categories() {
+		if cat == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Rule is a user-defined category rule loaded from a --rules file.
+// Every field that is set must match; Extensions match if any entry does.
+// Rules with a higher Priority are tried first; ties keep file order.
+type Rule struct {
+	Name       string   `json:"name" yaml:"name" toml:"name"`
+	Category   string   `json:"category" yaml:"category" toml:"category"`
+	Priority   int      `json:"priority" yaml:"priority" toml:"priority"`
+	Extensions []string `json:"extensions" yaml:"extensions" toml:"extensions"`
+	Glob       string   `json:"glob" yaml:"glob" toml:"glob"`
+	Regex      string   `json:"regex" yaml:"regex" toml:"regex"`
+	MinSize    string   `json:"min_size" yaml:"min_size" toml:"min_size"`
+	MaxSize    string   `json:"max_size" yaml:"max_size" toml:"max_size"`
+
+	re       *regexp.Regexp
+	minBytes int64
+	maxBytes int64 // 0 = unbounded
+}
+
+type rulesFile struct {
+	Rules     []Rule          `json:"rules" yaml:"rules" toml:"rules"`
+	Sidecars  []SidecarRule   `json:"sidecars" yaml:"sidecars" toml:"sidecars"`
+	Retention []RetentionRule `json:"retention" yaml:"retention" toml:"retention"`
+}
+
+// RuleSet classifies files using the loaded rules first and extToCategory
+// as the fallback. It is also the single source of truth for which
+// top-level folders under dst are category folders.
+type RuleSet struct {
+	rules     []Rule
+	sidecars  []SidecarRule // tried before defaultSidecarRules
+	retention []RetentionRule
+}
+
+// DefaultRules has no user rules and classifies purely by extToCategory.
+func DefaultRules() *RuleSet {
+	return &RuleSet{}
+}
+
+// LoadRules reads a rules file; the format is picked from the extension
+// (.json, .yaml/.yml or .toml).
+func LoadRules(path string) (*RuleSet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var rf rulesFile
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		err = json.Unmarshal(data, &rf)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &rf)
+	case ".toml":
+		err = toml.Unmarshal(data, &rf)
+	default:
+		return nil, fmt.Errorf("rules %q: unsupported format (want .json, .yaml or .toml)", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("rules %q: %w", path, err)
+	}
+
+	for i := range rf.Rules {
+		if err := rf.Rules[i].compile(); err != nil {
+			return nil, fmt.Errorf("rules %q: rule %d: %w", path, i+1, err)
+		}
+	}
+	sort.SliceStable(rf.Rules, func(a, b int) bool {
+		return rf.Rules[a].Priority > rf.Rules[b].Priority
+	})
+	for i := range rf.Sidecars {
+		if err := rf.Sidecars[i].compile(); err != nil {
+			return nil, fmt.Errorf("rules %q: %w", path, err)
+		}
+	}
+	for i := range rf.Retention {
+		if err := rf.Retention[i].compile(); err != nil {
+			return nil, fmt.Errorf("rules %q: retention rule %d: %w", path, i+1, err)
+		}
+	}
+	return &RuleSet{rules: rf.Rules, sidecars: rf.Sidecars, retention: rf.Retention}, nil
+}
+
+func (r *Rule) compile() error {
+	if r.Category == "" {
+		return fmt.Errorf("missing category")
+	}
+	if strings.ContainsAny(r.Category, `/\`) || r.Category == "." || r.Category == ".." {
+		return fmt.Errorf("category %q must be a plain folder name", r.Category)
+	}
+	for i, e := range r.Extensions {
+		e = strings.ToLower(e)
+		if !strings.HasPrefix(e, ".") {
+			e = "." + e
+		}
+		r.Extensions[i] = e
+	}
+	if r.Glob != "" {
+		if _, err := filepath.Match(r.Glob, ""); err != nil {
+			return fmt.Errorf("glob %q: %w", r.Glob, err)
+		}
+	}
+	if r.Regex != "" {
+		re, err := regexp.Compile(r.Regex)
+		if err != nil {
+			return fmt.Errorf("regex %q: %w", r.Regex, err)
+		}
+		r.re = re
+	}
+	var err error
+	if r.MinSize != "" {
+		if r.minBytes, err = ParseSize(r.MinSize); err != nil {
+			return err
+		}
+	}
+	if r.MaxSize != "" {
+		if r.maxBytes, err = ParseSize(r.MaxSize); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Rule) matches(name string, size int64) bool {
+	if len(r.Extensions) > 0 {
+		ext := strings.ToLower(filepath.Ext(name))
+		found := false
+		for _, e := range r.Extensions {
+			if e == ext {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if r.Glob != "" {
+		if ok, _ := filepath.Match(r.Glob, name); !ok {
+			return false
+		}
+	}
+	if r.re != nil && !r.re.MatchString(name) {
+		return false
+	}
+	if size < r.minBytes {
+		return false
+	}
+	if r.maxBytes > 0 && size > r.maxBytes {
+		return false
+	}
+	return true
+}
+
+// Classify returns the category for a file with the given base name and size.
+func (rs *RuleSet) Classify(name string, size int64) string {
+	for i := range rs.rules {
+		if rs.rules[i].matches(name, size) {
+			return rs.rules[i].Category
+		}
+	}
+	ext := strings.ToLower(filepath.Ext(name))
+	if category, ok := extToCategory[ext]; ok && category != "" {
+		return category
+	}
+	return "Other"
+}
+
+// Categories lists every folder name the rule set can produce, including
+// the built-in categories, "Projects" and "Other".
+func (rs *RuleSet) Categories() []string {
+	seen := map[string]bool{"Other": true, projectsCategory: true}
+	for _, c := range sniffCategories {
+		seen[c] = true
+	}
+	for _, c := range extToCategory {
+		seen[c] = true
+	}
+	for _, r := range rs.rules {
+		seen[r.Category] = true
+	}
+	cats := make([]string, 0, len(seen))
+	for c := range seen {
+		cats = append(cats, c)
+	}
+	sort.Strings(cats)
+	return cats
+}
+
+// IsCategory reports whether name is one of the rule set's category folders.
+func (rs *RuleSet) IsCategory(name string) bool {
+	return isCategory(rs, name)
+}
+
+// ParseSize accepts plain byte counts or a number with a KB/MB/GB/TB suffix
+// (binary multiples, case-insensitive, "B" optional): 512, 10KB, 1.5G.
+func ParseSize(s string) (int64, error) {
+	t := strings.ToUpper(strings.TrimSpace(s))
+	t = strings.TrimSuffix(t, "B")
+	mult := int64(1)
+	if n := len(t); n > 0 {
+		switch t[n-1] {
+		case 'K':
+			mult = 1 << 10
+		case 'M':
+			mult = 1 << 20
+		case 'G':
+			mult = 1 << 30
+		case 'T':
+			mult = 1 << 40
+		}
+		if mult > 1 {
+			t = t[:n-1]
+		}
+	}
+	v, err := strconv.ParseFloat(strings.TrimSpace(t), 64)
+	if err != nil || math.IsNaN(v) || v < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	// float64(math.MaxInt64) rounds up to 2^63, so >= catches every
+	// value int64 can't hold, infinity included
+	n := v * float64(mult)
+	if n >= math.MaxInt64 {
+		return 0, fmt.Errorf("size %q is too large", s)
+	}
+	return int64(n), nil
+}
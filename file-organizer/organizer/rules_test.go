@@ -0,0 +1,124 @@
+package organizer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int64 // -1 = invalid
+	}{
+		{"0", 0},
+		{"512", 512},
+		{"512B", 512},
+		{"10KB", 10 << 10},
+		{"10k", 10 << 10},
+		{" 1.5G ", 3 << 29},
+		{"2 MB", 2 << 20},
+		{"1TB", 1 << 40},
+		{"8388607T", 8388607 << 40},
+		{"8388608T", -1}, // 2^63
+		{"9223372036854775807", -1},
+		{"1e300", -1},
+		{"inf", -1},
+		{"+Inf", -1},
+		{"infKB", -1},
+		{"NaN", -1},
+		{"nanMB", -1},
+		{"-1", -1},
+		{"-0.5K", -1},
+		{"", -1},
+		{"KB", -1},
+		{"ten", -1},
+		{"10XB", -1},
+	}
+	for _, tt := range tests {
+		got, err := ParseSize(tt.in)
+		switch {
+		case tt.want < 0 && err == nil:
+			t.Errorf("%q: got %d, want an error", tt.in, got)
+		case tt.want >= 0 && (err != nil || got != tt.want):
+			t.Errorf("%q: got %d, %v; want %d", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestRuleCompile(t *testing.T) {
+	tests := []struct {
+		name string
+		rule Rule
+		ok   bool
+	}{
+		{"extensions only", Rule{Category: "Books", Extensions: []string{"epub", ".MOBI"}}, true},
+		{"all fields", Rule{Category: "Scans", Glob: "scan_*", Regex: `^\w+`, MinSize: "1KB", MaxSize: "1G"}, true},
+		{"missing category", Rule{Extensions: []string{".epub"}}, false},
+		{"nested category", Rule{Category: "Docs/Books"}, false},
+		{"backslash category", Rule{Category: `Docs\Books`}, false},
+		{"dot category", Rule{Category: "."}, false},
+		{"dot-dot category", Rule{Category: ".."}, false},
+		{"bad glob", Rule{Category: "X", Glob: "[a"}, false},
+		{"bad regex", Rule{Category: "X", Regex: "(a"}, false},
+		{"bad min size", Rule{Category: "X", MinSize: "lots"}, false},
+		{"overflowing max size", Rule{Category: "X", MaxSize: "1e30T"}, false},
+	}
+	for _, tt := range tests {
+		if err := tt.rule.compile(); (err == nil) != tt.ok {
+			t.Errorf("%s: err = %v, want ok = %v", tt.name, err, tt.ok)
+		}
+	}
+
+	r := Rule{Category: "Books", Extensions: []string{"epub", ".MOBI"}}
+	if err := r.compile(); err != nil {
+		t.Fatal(err)
+	}
+	if r.Extensions[0] != ".epub" || r.Extensions[1] != ".mobi" {
+		t.Errorf("extensions = %q, want lower case with a leading dot", r.Extensions)
+	}
+}
+
+func TestClassifyPriority(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	rules := `{"rules": [
+		{"name": "big videos", "category": "Footage", "extensions": ["mp4"], "min_size": "1MB"},
+		{"name": "screenshots", "category": "Screenshots", "glob": "Screenshot*", "priority": 10},
+		{"name": "invoices", "category": "Invoices", "regex": "(?i)invoice", "priority": 5},
+		{"name": "pngs", "category": "Pictures", "extensions": ["png"], "priority": 5},
+		{"name": "small", "category": "Small", "max_size": "10B"},
+		{"name": "any png", "category": "Later", "extensions": ["png"]}
+	]}`
+	if err := os.WriteFile(path, []byte(rules), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	rs, err := LoadRules(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		size int64
+		want string
+	}{
+		{"Screenshot 1.png", 100, "Screenshots"},     // priority 10 beats both priority 5 rules
+		{"invoice.png", 100, "Invoices"},             // equal priority keeps file order
+		{"photo.PNG", 100, "Pictures"},               // priority 5 beats the priority 0 png rule
+		{"clip.mp4", 2 << 20, "Footage"},             // priority 0 rules keep file order
+		{"clip.mp4", 5, "Small"},                     // too small for Footage
+		{"clip.mp4", 100, "Video"},                   // no rule: extension table
+		{"Screenshot.tiff", 1 << 30, "Screenshots"},  // glob alone
+		{"notes.unknownext", 100, "Other"},           // nothing matches
+		{"invoice-2024.unknownext", 100, "Invoices"}, // regex alone
+		{"readme.txt", 3, "Small"},                   // rules beat the extension table
+		{"scan.pdf", 100, "Docs"},                    // no rule: extension table
+	}
+	for _, tt := range tests {
+		if got := rs.Classify(tt.name, tt.size); got != tt.want {
+			t.Errorf("Classify(%q, %d) = %q, want %q", tt.name, tt.size, got, tt.want)
+		}
+	}
+	if !rs.IsCategory("Footage") || !rs.IsCategory("Other") || rs.IsCategory("Nope") {
+		t.Error("IsCategory doesn't follow the loaded rules")
+	}
+}
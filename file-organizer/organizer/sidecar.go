@@ -0,0 +1,281 @@
+package organizer
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SidecarRule groups files that share a base name so they are organized as
+// one unit. Primary lists extensions in priority order: the first one
+// present is the group's primary and decides its category, and any other
+// primaries with the same name (the JPG next to a RAW) travel with it.
+// Sidecars only ever travel with a primary; besides a.xmp they also match
+// a.cr2.xmp and, for subtitles, a.en.srt.
+type SidecarRule struct {
+	Name     string   `json:"name" yaml:"name" toml:"name"`
+	Primary  []string `json:"primary" yaml:"primary" toml:"primary"`
+	Sidecars []string `json:"sidecars" yaml:"sidecars" toml:"sidecars"`
+}
+
+// defaultSidecarRules apply after any rules from the --rules file.
+var defaultSidecarRules = []SidecarRule{
+	{
+		Name: "photo",
+		Primary: []string{".cr2", ".cr3", ".nef", ".arw", ".dng", ".raf", ".orf", ".rw2", ".pef", ".srw",
+			".jpg", ".jpeg", ".heic", ".heif", ".tif", ".tiff", ".png"},
+		Sidecars: []string{".xmp", ".aae", ".pp3", ".dop"},
+	},
+	{
+		Name:     "video",
+		Primary:  []string{".mp4", ".mkv", ".mov", ".avi", ".m4v", ".webm", ".wmv"},
+		Sidecars: []string{".srt", ".vtt", ".ass", ".ssa", ".sub", ".idx", ".nfo", ".thm", ".xmp"},
+	},
+}
+
+func (r *SidecarRule) compile() error {
+	if len(r.Primary) == 0 || len(r.Sidecars) == 0 {
+		return fmt.Errorf("sidecar rule %q needs primary and sidecars", r.Name)
+	}
+	for _, list := range [][]string{r.Primary, r.Sidecars} {
+		for i, e := range list {
+			e = strings.ToLower(e)
+			if !strings.HasPrefix(e, ".") {
+				e = "." + e
+			}
+			list[i] = e
+		}
+	}
+	return nil
+}
+
+func extIndex(list []string, ext string) int {
+	for i, e := range list {
+		if e == ext {
+			return i
+		}
+	}
+	return -1
+}
+
+// groupSidecars finds the groups among the file names of one directory.
+// It returns the members of each group keyed by primary name; files that
+// aren't in a group are not mentioned.
+func (rs *RuleSet) groupSidecars(names []string) map[string][]string {
+	sort.Strings(names)
+	taken := make(map[string]bool)
+	groups := make(map[string][]string)
+
+	for _, rule := range append(append([]SidecarRule(nil), rs.sidecars...), defaultSidecarRules...) {
+		// Pick the primary of each base name by priority.
+		primaryOf := make(map[string]string) // stem -> primary name
+		for _, n := range names {
+			if taken[n] {
+				continue
+			}
+			i := extIndex(rule.Primary, strings.ToLower(filepath.Ext(n)))
+			if i < 0 {
+				continue
+			}
+			stem := strings.TrimSuffix(n, filepath.Ext(n))
+			if cur, ok := primaryOf[stem]; !ok || i < extIndex(rule.Primary, strings.ToLower(filepath.Ext(cur))) {
+				primaryOf[stem] = n
+			}
+		}
+		if len(primaryOf) == 0 {
+			continue
+		}
+		byName := make(map[string]string, len(primaryOf)) // primary name -> primary name
+		for _, p := range primaryOf {
+			byName[p] = p
+		}
+
+		members := make(map[string][]string)
+		for _, n := range names {
+			if taken[n] {
+				continue
+			}
+			ext := strings.ToLower(filepath.Ext(n))
+			stem := strings.TrimSuffix(n, filepath.Ext(n))
+			var primary string
+			switch {
+			case extIndex(rule.Primary, ext) >= 0:
+				if p := primaryOf[stem]; p != n {
+					primary = p // a lower-priority twin
+				}
+			case extIndex(rule.Sidecars, ext) >= 0:
+				if p, ok := byName[stem]; ok { // a.cr2.xmp
+					primary = p
+				} else if p, ok := primaryOf[stem]; ok { // a.xmp
+					primary = p
+				} else if p, ok := primaryOf[strings.TrimSuffix(stem, filepath.Ext(stem))]; ok { // a.en.srt
+					primary = p
+				}
+			}
+			if primary != "" {
+				members[primary] = append(members[primary], n)
+			}
+		}
+		for p, ms := range members {
+			taken[p] = true
+			for _, m := range ms {
+				taken[m] = true
+			}
+			groups[p] = ms
+		}
+	}
+	return groups
+}
+
+// dirGroups is the grouping of one source directory.
+type dirGroups struct {
+	members map[string][]string // primary name -> its sidecars
+	primary map[string]string   // sidecar name -> its primary
+}
+
+// sidecarGroupsIn groups the files of dir that would be organized at all;
+// a file filtered out never pulls others along or gets pulled along.
+func sidecarGroupsIn(cfg *config, dir string) *dirGroups {
+	g := &dirGroups{primary: make(map[string]string)}
+	if !cfg.sidecars {
+		return g
+	}
+	entries, err := cfg.fs.ReadDir(dir)
+	if err != nil {
+		return g
+	}
+	var names []string
+	for _, e := range entries {
+		if !e.Type().IsRegular() {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		if skipFile(cfg, filepath.Join(dir, e.Name()), info) {
+			continue
+		}
+		names = append(names, e.Name())
+	}
+	g.members = cfg.rules.groupSidecars(names)
+	for p, ms := range g.members {
+		for _, m := range ms {
+			g.primary[m] = p
+		}
+	}
+	return g
+}
+
+// sidecarJobs stats the sidecars of primary in dir; ones that vanished
+// meanwhile are dropped.
+func (g *dirGroups) sidecarJobs(fsys FS, dir, primary string) []job {
+	var out []job
+	for _, m := range g.members[primary] {
+		p := filepath.Join(dir, m)
+		if info, err := fsys.Lstat(p); err == nil {
+			out = append(out, job{srcPath: p, info: info})
+		}
+	}
+	return out
+}
+
+// sidecarTarget names a sidecar after its primary's destination, keeping
+// whatever followed the primary's base name (.xmp, .en.srt, .CR2.xmp).
+func sidecarTarget(primarySrc, primaryDst, sidecarSrc string) string {
+	srcStem := strings.TrimSuffix(filepath.Base(primarySrc), filepath.Ext(primarySrc))
+	dstStem := strings.TrimSuffix(filepath.Base(primaryDst), filepath.Ext(primaryDst))
+	suffix := strings.TrimPrefix(filepath.Base(sidecarSrc), srcStem)
+	return filepath.Join(filepath.Dir(primaryDst), dstStem+suffix)
+}
+
+// sidecarDst is where sidecar s of primary j goes when j goes to dst. A
+// planned sidecar destination that was edited by hand is used as is;
+// otherwise the sidecar follows its primary, including conflict renames.
+func sidecarDst(j, s job, dst string) string {
+	if j.plan != nil && s.plan != nil && s.plan.Dst != sidecarTarget(j.srcPath, j.plan.Dst, s.srcPath) {
+		return s.plan.Dst
+	}
+	return sidecarTarget(j.srcPath, dst, s.srcPath)
+}
+
+// groupTaken reports whether the primary's target or any sidecar target
+// already exists.
+func groupTaken(fsys FS, j job, dst string) bool {
+	if exists(fsys, dst) {
+		return true
+	}
+	for _, s := range j.sidecars {
+		if exists(fsys, sidecarDst(j, s, dst)) {
+			return true
+		}
+	}
+	return false
+}
+
+// nextAvailableGroupName is nextAvailableName for a whole group: it finds
+// one " (n)" under which the primary and every sidecar are free.
+func nextAvailableGroupName(fsys FS, j job, dst string) (string, error) {
+	dir := filepath.Dir(dst)
+	ext := filepath.Ext(dst)
+	name := strings.TrimSuffix(filepath.Base(dst), ext)
+	for i := 1; i < 10_000; i++ {
+		candidate := filepath.Join(dir, fmt.Sprintf("%s (%d)%s", name, i, ext))
+		if !groupTaken(fsys, j, candidate) {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("too many name conflicts for %q", dst)
+}
+
+// placeSidecars moves (or copies/links) the sidecars next to the primary
+// once it is in place. With overwrite, existing sidecar targets are backed
+// up and replaced like the primary was.
+func placeSidecars(j job, dst, category string, overwrite bool, cfg *config) []result {
+	var out []result
+	for _, s := range j.sidecars {
+		target := sidecarDst(j, s, dst)
+		r := result{srcPath: s.srcPath, dstPath: target, action: "move", note: "sidecar of " + filepath.Base(j.srcPath),
+			bytes: s.info.Size(), group: j.srcPath, info: s.info, category: category}
+		start := time.Now()
+		m := Move{Src: s.srcPath, Dst: target, Mode: manifestMode(cfg.mover.Mode()), Group: j.srcPath, Category: category}
+		err := fingerprint(&m, s, cfg)
+		switch {
+		case err != nil:
+		case overwrite && exists(cfg.fs, target) && cfg.journal == nil:
+			err = cfg.place(s.srcPath, target)
+		case overwrite && exists(cfg.fs, target):
+			if m.Backup, err = backupPathFor(cfg, target); err == nil {
+				m.Action = actionOverwrite
+				err = cfg.apply(m, func() error {
+					return overwriteFile(cfg.mover, s.srcPath, target, m.Backup)
+				})
+			}
+		default:
+			err = cfg.apply(m, func() error {
+				return cfg.place(s.srcPath, target)
+			})
+		}
+		if err != nil {
+			r.err, r.action = err, ""
+		}
+		r.elapsed = time.Since(start)
+		out = append(out, r)
+	}
+	return out
+}
+
+// groupResults reports the sidecars of a primary that was not placed
+// (skipped, failed or handled as a duplicate): they stay where they are.
+func groupResults(j job, r result) []result {
+	if len(r.sidecars) > 0 || len(j.sidecars) == 0 {
+		return r.sidecars
+	}
+	out := make([]result, 0, len(j.sidecars))
+	for _, s := range j.sidecars {
+		out = append(out, result{srcPath: s.srcPath, action: "skip", note: "stays with " + filepath.Base(j.srcPath)})
+	}
+	return out
+}
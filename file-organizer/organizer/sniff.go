@@ -0,0 +1,216 @@
+package organizer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// sniffLen is how many leading bytes are read for content sniffing. It is
+// large enough to reach the tar header magic and the first ZIP entry names.
+const sniffLen = 4096
+
+// fileKind is a content type detected from a file's magic number.
+type fileKind struct {
+	ext      string   // canonical extension, "" if the type has none
+	aliases  []string // other extensions that are honest for this content
+	category string   // used when the rules can't place the file ("" = rules decide)
+}
+
+// accepts reports whether ext is an honest extension for this kind.
+func (k fileKind) accepts(ext string) bool {
+	if ext == k.ext {
+		return true
+	}
+	for _, a := range k.aliases {
+		if ext == a {
+			return true
+		}
+	}
+	return false
+}
+
+// Extensions that carry no real type information and are always safe to
+// replace when --fix-ext is on.
+var meaninglessExts = map[string]bool{
+	".bin": true, ".dat": true, ".tmp": true, ".file": true, ".download": true,
+}
+
+// sniffFile reads the leading bytes of path and detects its type.
+func sniffFile(fsys FS, path string) (fileKind, bool) {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return fileKind{}, false
+	}
+	defer f.Close()
+
+	buf := make([]byte, sniffLen)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return fileKind{}, false
+	}
+	return sniffBytes(buf[:n])
+}
+
+// sniffBytes classifies content by magic number.
+func sniffBytes(b []byte) (fileKind, bool) {
+	has := func(off int, magic string) bool {
+		return len(b) >= off+len(magic) && string(b[off:off+len(magic)]) == magic
+	}
+
+	switch {
+	// Images
+	case has(0, "\xFF\xD8\xFF"):
+		return fileKind{ext: ".jpg", aliases: []string{".jpeg", ".jpe", ".jfif"}}, true
+	case has(0, "\x89PNG\r\n\x1a\n"):
+		return fileKind{ext: ".png"}, true
+	case has(0, "GIF87a"), has(0, "GIF89a"):
+		return fileKind{ext: ".gif"}, true
+	case has(0, "RIFF") && has(8, "WEBP"):
+		return fileKind{ext: ".webp"}, true
+	case has(0, "BM") && isBMP(b):
+		return fileKind{ext: ".bmp"}, true
+	case has(0, "II*\x00"), has(0, "MM\x00*"):
+		// Many camera RAW formats are TIFF containers too.
+		return fileKind{ext: ".tiff", aliases: []string{".tif", ".dng", ".cr2", ".nef", ".arw", ".orf", ".rw2"}}, true
+
+	// ISO base media (MP4, MOV, HEIC, M4A) share the "ftyp" box.
+	case has(4, "ftyp"):
+		return sniffFtyp(b), true
+
+	// Video / audio
+	case has(0, "\x1A\x45\xDF\xA3"):
+		if bytes.Contains(b[:min(len(b), 64)], []byte("webm")) {
+			return fileKind{ext: ".webm"}, true
+		}
+		return fileKind{ext: ".mkv", aliases: []string{".mka", ".webm"}}, true
+	case has(0, "RIFF") && has(8, "AVI "):
+		return fileKind{ext: ".avi"}, true
+	case has(0, "RIFF") && has(8, "WAVE"):
+		return fileKind{ext: ".wav"}, true
+	case has(0, "FLV\x01"):
+		return fileKind{ext: ".flv"}, true
+	case has(0, "ID3"), len(b) >= 2 && b[0] == 0xFF && (b[1]&0xE6) == 0xE2:
+		return fileKind{ext: ".mp3"}, true
+	case has(0, "fLaC"):
+		return fileKind{ext: ".flac"}, true
+	case has(0, "OggS"):
+		return fileKind{ext: ".ogg", aliases: []string{".oga", ".ogv", ".opus"}}, true
+
+	// Documents
+	case has(0, "%PDF-"):
+		return fileKind{ext: ".pdf"}, true
+	case has(0, "{\\rtf"):
+		return fileKind{ext: ".rtf"}, true
+	case has(0, "\xD0\xCF\x11\xE0\xA1\xB1\x1A\xE1"):
+		// OLE2 compound file: legacy Office formats and MSI installers.
+		return fileKind{ext: ".doc", aliases: []string{".xls", ".ppt", ".msg", ".msi"}}, true
+
+	// Archives
+	case has(0, "PK\x03\x04"), has(0, "PK\x05\x06"):
+		return sniffZip(b), true
+	case has(0, "\x1F\x8B"):
+		return fileKind{ext: ".gz", aliases: []string{".tgz"}}, true
+	case has(0, "Rar!\x1A\x07"):
+		return fileKind{ext: ".rar"}, true
+	case has(0, "7z\xBC\xAF\x27\x1C"):
+		return fileKind{ext: ".7z"}, true
+	case has(257, "ustar"):
+		return fileKind{ext: ".tar"}, true
+
+	// Executables
+	case has(0, "\x7FELF"):
+		return fileKind{aliases: []string{".so", ".o", ".elf", ".bin"}, category: "Programs"}, true
+	case has(0, "MZ") && isPE(b):
+		return fileKind{ext: ".exe", aliases: []string{".dll", ".sys", ".scr"}, category: "Programs"}, true
+	}
+	return fileKind{}, false
+}
+
+// isBMP checks the DIB header size, since "BM" alone is too common a prefix.
+func isBMP(b []byte) bool {
+	if len(b) < 18 {
+		return false
+	}
+	switch binary.LittleEndian.Uint32(b[14:18]) {
+	case 12, 40, 52, 56, 64, 108, 124:
+		return true
+	}
+	return false
+}
+
+// isPE follows the DOS header's e_lfanew to the "PE\0\0" signature.
+func isPE(b []byte) bool {
+	if len(b) < 64 {
+		return false
+	}
+	off := int(binary.LittleEndian.Uint32(b[60:64]))
+	return off > 0 && off+4 <= len(b) && string(b[off:off+4]) == "PE\x00\x00"
+}
+
+func sniffFtyp(b []byte) fileKind {
+	brand := ""
+	if len(b) >= 12 {
+		brand = string(b[8:12])
+	}
+	switch brand {
+	case "heic", "heix", "hevc", "hevx", "mif1", "msf1":
+		return fileKind{ext: ".heic", aliases: []string{".heif"}}
+	case "avif":
+		return fileKind{ext: ".avif"}
+	case "qt  ":
+		return fileKind{ext: ".mov"}
+	case "M4A ", "M4B ":
+		return fileKind{ext: ".m4a", aliases: []string{".m4b"}}
+	}
+	return fileKind{ext: ".mp4", aliases: []string{".m4v", ".mov", ".3gp"}}
+}
+
+// sniffZip tells OOXML and other ZIP-based formats apart by the entry
+// names that appear in the first local headers.
+func sniffZip(b []byte) fileKind {
+	zipAliases := []string{".docx", ".xlsx", ".pptx", ".odt", ".ods", ".odp", ".epub", ".jar", ".apk"}
+	switch {
+	case bytes.Contains(b, []byte("word/")):
+		return fileKind{ext: ".docx"}
+	case bytes.Contains(b, []byte("xl/")):
+		return fileKind{ext: ".xlsx"}
+	case bytes.Contains(b, []byte("ppt/")):
+		return fileKind{ext: ".pptx"}
+	case bytes.Contains(b, []byte("mimetypeapplication/epub+zip")):
+		return fileKind{ext: ".epub"}
+	}
+	return fileKind{ext: ".zip", aliases: zipAliases}
+}
+
+// sniffCategories are the categories sniffing can produce on its own.
+var sniffCategories = []string{"Programs"}
+
+// sniffName applies content sniffing to a file. It returns the name to
+// classify by, the name to use at the destination (corrected only when
+// fixExt is set) and a fallback category for kinds the rules can't place.
+// Unknown content and honest extensions leave the name unchanged.
+func sniffName(fsys FS, path, name string, fixExt bool) (classifyAs, dstName, category string) {
+	k, ok := sniffFile(fsys, path)
+	if !ok {
+		return name, name, ""
+	}
+	ext := strings.ToLower(filepath.Ext(name))
+	if k.accepts(ext) {
+		return name, name, k.category
+	}
+
+	// Replace extensions we recognise as lying; anything else ("report.v2")
+	// is probably part of the name, so the real extension is appended.
+	stem := name
+	if _, known := extToCategory[ext]; known || meaninglessExts[ext] {
+		stem = strings.TrimSuffix(name, filepath.Ext(name))
+	}
+	corrected := stem + k.ext
+	if fixExt {
+		return corrected, corrected, k.category
+	}
+	return corrected, name, k.category
+}
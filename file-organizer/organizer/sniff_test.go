@@ -0,0 +1,155 @@
+package organizer
+
+import (
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+// at returns a header of n zero bytes with magic written at off.
+func at(n, off int, magic string) string {
+	b := make([]byte, max(n, off+len(magic)))
+	copy(b[off:], magic)
+	return string(b)
+}
+
+func TestSniffBytes(t *testing.T) {
+	bmp := []byte(at(32, 0, "BM"))
+	binary.LittleEndian.PutUint32(bmp[14:], 40)
+	pe := []byte(at(128, 0, "MZ"))
+	binary.LittleEndian.PutUint32(pe[60:], 64)
+	copy(pe[64:], "PE\x00\x00")
+	const (
+		zipHeader  = "PK\x03\x04\x14\x00\x00\x00\x08\x00photos/a.jpg"
+		docxHeader = "PK\x03\x04\x14\x00\x06\x00[Content_Types].xml PK\x03\x04 word/document.xml"
+	)
+
+	tests := []struct {
+		name     string
+		header   string
+		ext      string // "" with ok = false means unknown content
+		category string
+		ok       bool
+		honest   []string // other extensions the kind must accept
+	}{
+		{"jpeg", "\xFF\xD8\xFF\xE0\x00\x10JFIF", ".jpg", "", true, []string{".jpeg", ".jfif"}},
+		{"png", "\x89PNG\r\n\x1a\n", ".png", "", true, nil},
+		{"gif", "GIF89a", ".gif", "", true, nil},
+		{"webp", "RIFF\x00\x00\x00\x00WEBPVP8 ", ".webp", "", true, nil},
+		{"bmp", string(bmp), ".bmp", "", true, nil},
+		{"tiff little-endian", "II*\x00\x08\x00\x00\x00", ".tiff", "", true, []string{".tif", ".dng", ".cr2", ".nef", ".arw", ".orf", ".rw2"}},
+		{"tiff big-endian", "MM\x00*\x00\x00\x00\x08", ".tiff", "", true, []string{".nef", ".dng"}},
+		{"heic", "\x00\x00\x00\x18ftypheic", ".heic", "", true, []string{".heif"}},
+		{"avif", "\x00\x00\x00\x18ftypavif", ".avif", "", true, nil},
+		{"mov", "\x00\x00\x00\x14ftypqt  ", ".mov", "", true, nil},
+		{"m4a", "\x00\x00\x00\x18ftypM4A ", ".m4a", "", true, []string{".m4b"}},
+		{"mp4", "\x00\x00\x00\x18ftypisom", ".mp4", "", true, []string{".m4v", ".mov"}},
+		{"mkv", "\x1A\x45\xDF\xA3\x9F\x42\x82\x88matroska", ".mkv", "", true, []string{".mka", ".webm"}},
+		{"webm", "\x1A\x45\xDF\xA3\x9F\x42\x82\x84webm", ".webm", "", true, nil},
+		{"avi", "RIFF\x00\x00\x00\x00AVI LIST", ".avi", "", true, nil},
+		{"wav", "RIFF\x00\x00\x00\x00WAVEfmt ", ".wav", "", true, nil},
+		{"flv", "FLV\x01\x05", ".flv", "", true, nil},
+		{"mp3 with ID3", "ID3\x04\x00", ".mp3", "", true, nil},
+		{"mp3 frame", "\xFF\xFB\x90\x00", ".mp3", "", true, nil},
+		{"flac", "fLaC\x00\x00\x00\x22", ".flac", "", true, nil},
+		{"ogg", "OggS\x00\x02", ".ogg", "", true, []string{".opus"}},
+		{"pdf", "%PDF-1.7\n", ".pdf", "", true, nil},
+		{"rtf", `{\rtf1\ansi`, ".rtf", "", true, nil},
+		{"ole2", "\xD0\xCF\x11\xE0\xA1\xB1\x1A\xE1", ".doc", "", true, []string{".xls", ".msi"}},
+		{"zip", zipHeader, ".zip", "", true, []string{".docx", ".jar", ".epub"}},
+		{"empty zip", "PK\x05\x06" + strings.Repeat("\x00", 18), ".zip", "", true, nil},
+		{"docx", docxHeader, ".docx", "", true, nil},
+		{"xlsx", "PK\x03\x04\x14\x00\x06\x00[Content_Types].xml PK\x03\x04 xl/workbook.xml", ".xlsx", "", true, nil},
+		{"pptx", "PK\x03\x04\x14\x00\x06\x00[Content_Types].xml PK\x03\x04 ppt/presentation.xml", ".pptx", "", true, nil},
+		{"epub", "PK\x03\x04\x0a\x00\x00\x00\x00\x00mimetypeapplication/epub+zip", ".epub", "", true, nil},
+		{"gzip", "\x1F\x8B\x08\x00", ".gz", "", true, []string{".tgz"}},
+		{"rar", "Rar!\x1A\x07\x01\x00", ".rar", "", true, nil},
+		{"7z", "7z\xBC\xAF\x27\x1C\x00\x04", ".7z", "", true, nil},
+		{"tar", at(512, 257, "ustar\x0000"), ".tar", "", true, nil},
+		{"elf", "\x7FELF\x02\x01\x01", "", "Programs", true, []string{"", ".so", ".o", ".bin"}},
+		{"pe", string(pe), ".exe", "Programs", true, []string{".dll"}},
+		{"plain text", "hello, world\n", "", "", false, nil},
+		{"BM without a DIB header", "BM, as in the initials", "", "", false, nil},
+		{"MZ without a PE header", at(128, 0, "MZ"), "", "", false, nil},
+		{"truncated png", "\x89PN", "", "", false, nil},
+		{"empty", "", "", "", false, nil},
+	}
+	for _, tt := range tests {
+		k, ok := sniffBytes([]byte(tt.header))
+		if ok != tt.ok || k.ext != tt.ext || k.category != tt.category {
+			t.Errorf("%s: got (%q, %q, %v), want (%q, %q, %v)", tt.name, k.ext, k.category, ok, tt.ext, tt.category, tt.ok)
+			continue
+		}
+		if ok && !k.accepts(tt.ext) {
+			t.Errorf("%s: doesn't accept its own extension %q", tt.name, tt.ext)
+		}
+		for _, ext := range tt.honest {
+			if !k.accepts(ext) {
+				t.Errorf("%s: doesn't accept %q", tt.name, ext)
+			}
+		}
+	}
+
+	// OOXML documents are told apart from plain ZIPs, so an OOXML file
+	// named .zip is lying while a plain ZIP named .docx is not
+	docx, _ := sniffBytes([]byte(docxHeader))
+	zip, _ := sniffBytes([]byte(zipHeader))
+	if docx.accepts(".zip") || !zip.accepts(".docx") {
+		t.Errorf("ZIP/OOXML split: docx accepts .zip = %v, zip accepts .docx = %v", docx.accepts(".zip"), zip.accepts(".docx"))
+	}
+}
+
+func TestSniffName(t *testing.T) {
+	const (
+		jpeg = "\xFF\xD8\xFF\xE0\x00\x10JFIF"
+		pdf  = "%PDF-1.7\n"
+		tiff = "II*\x00\x08\x00\x00\x00"
+		elf  = "\x7FELF\x02\x01\x01"
+		docx = "PK\x03\x04\x14\x00\x06\x00 word/document.xml"
+	)
+	tests := []struct {
+		name, content string
+		classifyAs    string // also the destination name with fixExt on
+		category      string
+	}{
+		// Honest extensions, including case and aliases, are left alone
+		{"photo.jpg", jpeg, "photo.jpg", ""},
+		{"photo.JPEG", jpeg, "photo.JPEG", ""},
+		{"IMG_0001.CR2", tiff, "IMG_0001.CR2", ""},
+		{"tool", elf, "tool", "Programs"},
+		{"firmware.bin", elf, "firmware.bin", "Programs"},
+
+		// Lying extensions are replaced
+		{"invoice.jpg", pdf, "invoice.pdf", ""},
+		{"letter.zip", docx, "letter.docx", ""},
+
+		// Meaningless extensions are replaced
+		{"scan.bin", pdf, "scan.pdf", ""},
+		{"photo.download", jpeg, "photo.jpg", ""},
+
+		// Unknown suffixes are kept as part of the name
+		{"report.v2", pdf, "report.v2.pdf", ""},
+		{"report", pdf, "report.pdf", ""},
+
+		// Unknown content leaves the name unchanged
+		{"notes.pdf", "just text", "notes.pdf", ""},
+	}
+	files := make(map[string]string)
+	for _, tt := range tests {
+		files["src/"+tt.name] = tt.content
+	}
+	m := memTree(t, files)
+	for _, tt := range tests {
+		for _, fixExt := range []bool{false, true} {
+			classifyAs, dstName, category := sniffName(m, "/src/"+tt.name, tt.name, fixExt)
+			wantDst := tt.name
+			if fixExt {
+				wantDst = tt.classifyAs
+			}
+			if classifyAs != tt.classifyAs || dstName != wantDst || category != tt.category {
+				t.Errorf("%s (fixExt %v): got (%q, %q, %q), want (%q, %q, %q)",
+					tt.name, fixExt, classifyAs, dstName, category, tt.classifyAs, wantDst, tt.category)
+			}
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package organizer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// trashDirName is the folder under dstRoot that expired files and
+// extracted archives go to.
+// Like the freedesktop.org trash, files/ holds the files and info/ a
+// <name>.json for each, saying where it came from.
+const trashDirName = ".organizer-trash"
+
+const trashInfoExt = ".json"
+
+func trashDirs(dstRoot string) (files, info string) {
+	root := filepath.Join(dstRoot, trashDirName)
+	return filepath.Join(root, "files"), filepath.Join(root, "info")
+}
+
+// trashInfoPath is where the metadata of a file in files/ is kept.
+func trashInfoPath(file string) string {
+	return filepath.Join(filepath.Dir(filepath.Dir(file)), "info", filepath.Base(file)+trashInfoExt)
+}
+
+// ownDir reports whether a directory name is one the organizer keeps its
+// own records in; walks never descend into those.
+func ownDir(name string) bool {
+	return name == manifestDirName || name == trashDirName
+}
+
+// TrashItem is one file in the trash.
+type TrashItem struct {
+	Name     string    `json:"-"`    // file name in the trash; what Restore takes
+	Path     string    `json:"path"` // where it was expired from
+	Trashed  time.Time `json:"trashed"`
+	Category string    `json:"category,omitempty"`
+	Size     int64     `json:"size"`
+	ModTime  time.Time `json:"mod_time"`
+	Reason   string    `json:"reason,omitempty"`   // the retention rule, or what an archive was extracted to
+	Manifest string    `json:"manifest,omitempty"` // journal of the run that expired it, for Undo
+}
+
+// TrashItems lists the trash under dstRoot, oldest first. Files without
+// metadata (say, after a crash) are listed with an empty Path.
+func TrashItems(dstRoot string) ([]TrashItem, error) {
+	files, _ := trashDirs(dstRoot)
+	entries, err := os.ReadDir(files)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var items []TrashItem
+	for _, e := range entries {
+		item := TrashItem{Name: e.Name()}
+		if data, err := os.ReadFile(trashInfoPath(filepath.Join(files, e.Name()))); err == nil {
+			_ = json.Unmarshal(data, &item)
+		}
+		if item.Trashed.IsZero() {
+			if info, err := e.Info(); err == nil {
+				item.Trashed, item.Size, item.ModTime = info.ModTime(), info.Size(), info.ModTime()
+			}
+		}
+		items = append(items, item)
+	}
+	sort.SliceStable(items, func(a, b int) bool { return items[a].Trashed.Before(items[b].Trashed) })
+	return items, nil
+}
+
+// RestoreTrash puts the named trash items back where they were expired
+// from (under a free name if that is taken again), reporting each to w.
+// Restored items are no longer in the trash, so undoing the run that
+// expired them skips them.
+func RestoreTrash(dstRoot string, names []string, dryRun bool, w io.Writer) error {
+	items, err := TrashItems(dstRoot)
+	if err != nil {
+		return err
+	}
+	byName := make(map[string]TrashItem, len(items))
+	for _, it := range items {
+		byName[it.Name] = it
+	}
+	files, _ := trashDirs(dstRoot)
+	var restored, failed int
+	for _, name := range names {
+		it, ok := byName[name]
+		switch {
+		case !ok:
+			fmt.Fprintf(w, "ERROR  %s is not in the trash\n", name)
+			failed++
+			continue
+		case it.Path == "":
+			fmt.Fprintf(w, "ERROR  %s has no record of where it came from; move it out of %s by hand\n", name, files)
+			failed++
+			continue
+		}
+		src, target := filepath.Join(files, name), it.Path
+		if exists(OS, target) {
+			if target, err = nextAvailableName(OS, target); err != nil {
+				fmt.Fprintf(w, "ERROR  restore %s -> %s (%v)\n", src, it.Path, err)
+				failed++
+				continue
+			}
+		}
+		if dryRun {
+			fmt.Fprintf(w, "DRYRUN RESTORE %s -> %s\n", src, target)
+			restored++
+			continue
+		}
+		err := os.MkdirAll(filepath.Dir(target), 0o755)
+		if err == nil {
+			err = moveFile(OS, src, target)
+		}
+		if err != nil {
+			fmt.Fprintf(w, "ERROR  restore %s -> %s (%v)\n", src, target, err)
+			failed++
+			continue
+		}
+		_ = os.Remove(trashInfoPath(src))
+		fmt.Fprintf(w, "RESTORED %s -> %s\n", src, target)
+		restored++
+	}
+	fmt.Fprintf(w, "\nRestore summary: restored=%d failed=%d\n", restored, failed)
+	if failed > 0 {
+		return fmt.Errorf("%d item(s) could not be restored", failed)
+	}
+	return nil
+}
+
+// EmptyTrash deletes, for good, the trash items under dstRoot trashed
+// before before (all of them if it is zero), reporting each to w.
+func EmptyTrash(dstRoot string, before time.Time, dryRun bool, w io.Writer) error {
+	items, err := TrashItems(dstRoot)
+	if err != nil {
+		return err
+	}
+	files, infoDir := trashDirs(dstRoot)
+	var deleted, failed int
+	var freed int64
+	for _, it := range items {
+		if !before.IsZero() && !it.Trashed.Before(before) {
+			continue
+		}
+		path := filepath.Join(files, it.Name)
+		if dryRun {
+			fmt.Fprintf(w, "DRYRUN DELETE %s\n", path)
+			deleted++
+			freed += it.Size
+			continue
+		}
+		if err := os.RemoveAll(path); err != nil {
+			fmt.Fprintf(w, "ERROR  delete %s (%v)\n", path, err)
+			failed++
+			continue
+		}
+		_ = os.Remove(trashInfoPath(path))
+		fmt.Fprintf(w, "DELETED %s\n", path)
+		deleted++
+		freed += it.Size
+	}
+	if !dryRun {
+		removeOrphanTrashInfo(files, infoDir)
+	}
+	fmt.Fprintf(w, "\nEmpty summary: deleted=%d failed=%d freed=%d bytes\n", deleted, failed, freed)
+	return nil
+}
+
+// removeOrphanTrashInfo drops metadata whose file is gone, which an
+// expiry interrupted before the move leaves behind.
+func removeOrphanTrashInfo(files, infoDir string) {
+	entries, err := os.ReadDir(infoDir)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		name := strings.TrimSuffix(e.Name(), trashInfoExt)
+		if !exists(OS, filepath.Join(files, name)) {
+			_ = os.Remove(filepath.Join(infoDir, e.Name()))
+		}
+	}
+}
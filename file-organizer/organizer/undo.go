@@ -0,0 +1,441 @@
+package organizer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// errModified marks an organized file that was edited afterwards; undo
+// leaves it alone unless forced.
+var errModified = errors.New("modified since it was organized")
+
+// manifestDirName is the folder under dstRoot that holds undo manifests.
+const manifestDirName = ".organizer-manifests"
+
+// UndoOptions narrow what Undo reverts and how careful it is.
+type UndoOptions struct {
+	DryRun bool
+	Force  bool // undo files even if they changed since they were organized
+
+	// Filters; an entry must match all that are set. Selecting one file
+	// of a group (a photo and its sidecars) selects the whole group.
+	Categories []string
+	Globs      []string  // gitignore-style, matched against dst (relative to the dest root) and src
+	Since      time.Time // organized at or after
+	Until      time.Time // organized before
+
+	// Classifier names the category folders, used for manifests that
+	// predate recorded categories and to remove emptied folders. Nil
+	// means the built-in categories.
+	Classifier Classifier
+	Out        io.Writer // one line per change; nil means os.Stdout
+
+	globs []ignorePattern
+}
+
+func (o UndoOptions) withDefaults() UndoOptions {
+	if o.Classifier == nil {
+		o.Classifier = DefaultRules()
+	}
+	if o.Out == nil {
+		o.Out = os.Stdout
+	}
+	o.globs = compilePatterns(o.Globs)
+	return o
+}
+
+func (o UndoOptions) filtered() bool {
+	return len(o.Categories) > 0 || len(o.globs) > 0 || !o.Since.IsZero() || !o.Until.IsZero()
+}
+
+// selectMoves keeps the entries of a manifest that opts select, in order.
+func selectMoves(moves []Move, root string, opts UndoOptions) []Move {
+	if !opts.filtered() {
+		return moves
+	}
+	groups := make(map[string]bool)
+	picked := make([]bool, len(moves))
+	for i, m := range moves {
+		if opts.matches(m, root) {
+			picked[i] = true
+			if m.Group != "" {
+				groups[m.Group] = true
+			}
+		}
+	}
+	var out []Move
+	for i, m := range moves {
+		if picked[i] || (m.Group != "" && groups[m.Group]) {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+func (o UndoOptions) matches(m Move, root string) bool {
+	if !o.Since.IsZero() && m.When.Before(o.Since) {
+		return false
+	}
+	if !o.Until.IsZero() && !m.When.Before(o.Until) {
+		return false
+	}
+	if len(o.Categories) > 0 {
+		category := movedCategory(m, root, o.Classifier)
+		found := false
+		for _, c := range o.Categories {
+			if strings.EqualFold(c, category) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(o.globs) > 0 {
+		paths := []string{filepath.ToSlash(strings.TrimPrefix(m.Src, string(filepath.Separator)))}
+		if rel, err := filepath.Rel(root, m.Dst); err == nil && !strings.HasPrefix(rel, "..") {
+			paths = append(paths, filepath.ToSlash(rel))
+		}
+		found := false
+		for _, p := range o.globs {
+			for _, path := range paths {
+				if p.re.MatchString(path) {
+					found = true
+				}
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// movedCategory is the category an entry was filed under. Manifests from
+// before categories were recorded fall back to the first category folder
+// in the destination path.
+func movedCategory(m Move, root string, c Classifier) string {
+	if m.Category != "" {
+		return m.Category
+	}
+	rel, err := filepath.Rel(root, m.Dst)
+	if err != nil {
+		return ""
+	}
+	for _, part := range strings.Split(filepath.Dir(rel), string(filepath.Separator)) {
+		if isCategory(c, part) {
+			return part
+		}
+	}
+	return ""
+}
+
+// fingerprint records the size and SHA-256 of a file about to be moved,
+// so undo can tell whether it was edited since. Other modes need none:
+// undo compares copies and links with the original, which is still there.
+func fingerprint(m *Move, j job, cfg *config) error {
+	if cfg.journal == nil || cfg.mover.Mode() != ModeMove || !j.info.Mode().IsRegular() {
+		return nil
+	}
+	sum, err := hashFile(cfg.fs, j.srcPath)
+	if err != nil {
+		return err
+	}
+	m.Size, m.Hash = j.info.Size(), sum
+	return nil
+}
+
+// verifyUnchanged checks an organized file, or a copied project or
+// extracted folder, against its fingerprint; for a deleted or linked
+// duplicate, it checks the kept copy it is restored from. Entries without
+// one (file copies, links, moved projects, older manifests) pass.
+func verifyUnchanged(m Move) error {
+	if m.Hash == "" {
+		return nil
+	}
+	if m.Action == actionExtract || m.Action == actionProject {
+		sum, _, err := treeDigest(m.Dst)
+		if err != nil {
+			return err
+		}
+		if sum != m.Hash {
+			return errModified
+		}
+		return nil
+	}
+	info, err := os.Stat(m.Dst)
+	if err != nil {
+		return err
+	}
+	if info.Size() != m.Size {
+		return errModified
+	}
+	sum, err := hashFile(OS, m.Dst)
+	if err != nil {
+		return err
+	}
+	if sum != m.Hash {
+		return errModified
+	}
+	return nil
+}
+
+// Undo reverts the changes in a manifest (a JSONL journal or a legacy
+// JSON manifest) that opts select, reporting each one to opts.Out. In a
+// journal, each reverted change is marked undone so undoing the same
+// manifest again (say, with different filters) doesn't revisit it.
+func Undo(manifest string, opts UndoOptions) error {
+	opts = opts.withDefaults()
+	w := opts.Out
+	moves, err := loadManifest(manifest, w)
+	if err != nil {
+		return err
+	}
+	dryRun := opts.DryRun
+
+	// dstRoot is the directory that contains .organizer-manifests
+	root := filepath.Dir(filepath.Dir(manifest))
+	moves = selectMoves(moves, root, opts)
+
+	var jr *journal
+	if !dryRun && strings.HasSuffix(manifest, ".jsonl") && len(moves) > 0 {
+		if jr, err = openJournalForAppend(manifest); err != nil {
+			return err
+		}
+		defer jr.Close()
+	}
+	var undone, skipped, failed int
+	done := func(m Move) {
+		undone++
+		if jr == nil {
+			return
+		}
+		if err := jr.markUndone(m.seq); err != nil {
+			fmt.Fprintf(w, "WARN   could not mark %s undone in %s (%v)\n", m.Dst, manifest, err)
+		}
+	}
+	// unchanged reports whether m's file may be put back, saying why not.
+	unchanged := func(m Move) bool {
+		if opts.Force {
+			return true
+		}
+		if err := verifyUnchanged(m); err != nil {
+			if errors.Is(err, errModified) {
+				fmt.Fprintf(w, "SKIP   %s (%v; use -force to undo anyway)\n", m.Dst, err)
+			} else {
+				fmt.Fprintf(w, "SKIP   %s (%v)\n", m.Dst, err)
+			}
+			skipped++
+			return false
+		}
+		return true
+	}
+
+	// Restore deleted and hard-linked duplicates first, while the kept
+	// copies they were checked against are still in place.
+	for _, m := range moves {
+		if m.Action != actionDeleteDuplicate && m.Action != actionHardlink {
+			continue
+		}
+		if !exists(OS, m.Dst) {
+			fmt.Fprintf(w, "SKIP   missing kept copy: %s (cannot restore %s)\n", m.Dst, m.Src)
+			skipped++
+			continue
+		}
+		if m.Action == actionDeleteDuplicate && exists(OS, m.Src) {
+			fmt.Fprintf(w, "SKIP   exists: %s\n", m.Src)
+			skipped++
+			continue
+		}
+		if !unchanged(m) {
+			continue
+		}
+		if dryRun {
+			fmt.Fprintf(w, "DRYRUN UNDO %s <= copy of %s\n", m.Src, m.Dst)
+			undone++
+			continue
+		}
+		if err := restoreCopy(m.Dst, m.Src); err != nil {
+			fmt.Fprintf(w, "ERROR  undo %s <= %s (%v)\n", m.Src, m.Dst, err)
+			failed++
+			continue
+		}
+		fmt.Fprintf(w, "UNDONE %s <= copy of %s\n", m.Src, m.Dst)
+		done(m)
+	}
+
+	// Reverse order to safely unwind nested moves
+	for i := len(moves) - 1; i >= 0; i-- {
+		m := moves[i]
+		switch m.Action {
+		case "", actionMoveDuplicate, actionOverwrite, actionProject, actionExpire, actionTrash, actionExtract:
+		default:
+			continue
+		}
+		// Put back the file an overwrite replaced
+		restoreBackup := func() {
+			if m.Action != actionOverwrite || m.Backup == "" {
+				return
+			}
+			if err := moveFile(OS, m.Backup, m.Dst); err != nil {
+				fmt.Fprintf(w, "ERROR  restore %s -> %s (%v)\n", m.Backup, m.Dst, err)
+				failed++
+				return
+			}
+			fmt.Fprintf(w, "RESTORED %s -> %s\n", m.Backup, m.Dst)
+			pruneEmptyParents(filepath.Dir(m.Backup), root)
+		}
+
+		// Extracted folders are removed; the archive is still there
+		if m.Action == actionExtract {
+			if !exists(OS, m.Dst) {
+				fmt.Fprintf(w, "SKIP   missing: %s (already moved/deleted)\n", m.Dst)
+				skipped++
+				continue
+			}
+			if !unchanged(m) {
+				continue
+			}
+			if dryRun {
+				fmt.Fprintf(w, "DRYRUN UNDO remove %s (extracted from %s)\n", m.Dst, m.Src)
+				undone++
+				continue
+			}
+			if err := os.RemoveAll(m.Dst); err != nil {
+				fmt.Fprintf(w, "ERROR  undo remove %s (%v)\n", m.Dst, err)
+				failed++
+				continue
+			}
+			fmt.Fprintf(w, "REMOVED %s (extracted from %s)\n", m.Dst, m.Src)
+			done(m)
+			pruneEmptyParents(filepath.Dir(m.Dst), root)
+			continue
+		}
+
+		// Copies and links are removed; the original was never touched
+		if m.Mode != "" {
+			if m.Action == actionProject && !unchanged(m) {
+				continue
+			}
+			if dryRun {
+				fmt.Fprintf(w, "DRYRUN UNDO remove %s (%s of %s)\n", m.Dst, m.Mode, m.Src)
+				undone++
+				continue
+			}
+			if err := undoPlaced(m); err != nil {
+				fmt.Fprintf(w, "SKIP   %s (%v)\n", m.Dst, err)
+				skipped++
+				continue
+			}
+			fmt.Fprintf(w, "REMOVED %s (%s of %s)\n", m.Dst, m.Mode, m.Src)
+			done(m)
+			restoreBackup()
+			pruneEmptyParents(filepath.Dir(m.Dst), root)
+			continue
+		}
+
+		if !exists(OS, m.Dst) {
+			fmt.Fprintf(w, "SKIP   missing: %s (already moved/deleted)\n", m.Dst)
+			skipped++
+			continue
+		}
+		if !unchanged(m) {
+			continue
+		}
+		target := m.Src
+		if exists(OS, target) {
+			// Don’t clobber anything that reappeared at the original location
+			var err error
+			target, err = nextAvailableName(OS, target)
+			if err != nil {
+				fmt.Fprintf(w, "ERROR  undo %s -> %s (%v)\n", m.Dst, target, err)
+				failed++
+				continue
+			}
+		}
+		if dryRun {
+			fmt.Fprintf(w, "DRYRUN UNDO %s -> %s\n", m.Dst, target)
+			undone++
+			continue
+		}
+		// Expiry and extraction remove the folders they empty
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			fmt.Fprintf(w, "ERROR  undo %s -> %s (%v)\n", m.Dst, target, err)
+			failed++
+			continue
+		}
+		if err := moveFile(OS, m.Dst, target); err != nil {
+			fmt.Fprintf(w, "ERROR  undo %s -> %s (%v)\n", m.Dst, target, err)
+			failed++
+			continue
+		}
+		fmt.Fprintf(w, "UNDONE %s -> %s\n", m.Dst, target)
+		done(m)
+		restoreBackup()
+		if m.Action == actionExpire || m.Action == actionTrash {
+			_ = os.Remove(trashInfoPath(m.Dst))
+			pruneEmptyParents(filepath.Dir(trashInfoPath(m.Dst)), root)
+		}
+		pruneEmptyParents(filepath.Dir(m.Dst), root)
+	}
+	fmt.Fprintf(w, "\nUndo summary: undone=%d skipped=%d failed=%d\n", undone, skipped, failed)
+	// Try to remove empty category dirs in the directory that contained the manifest.
+	if !dryRun {
+		if root != "" {
+			removeEmptyCategoryDirs(root, opts.Classifier)
+		}
+	}
+	return nil
+}
+
+// removeEmptyCategoryDirs deletes empty category folders under dstRoot.
+// Safe: only removes the known category directories if they are empty.
+func removeEmptyCategoryDirs(dstRoot string, c Classifier) {
+	for _, c := range c.Categories() {
+		dir := filepath.Join(dstRoot, c)
+		// Only attempt if the dir exists
+		if fi, err := os.Stat(dir); err == nil && fi.IsDir() {
+			// Check emptiness
+			empty := true
+			_ = filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+				if err != nil {
+					return nil
+				}
+				if p != dir {
+					empty = false
+					return fmt.Errorf("stop")
+				} // early stop
+				return nil
+			})
+			if empty {
+				_ = os.Remove(dir) // remove empty dir
+			}
+		}
+	}
+}
+
+// pruneEmptyParents removes dir and its parents while they are empty,
+// stopping at (and never removing) root. Used to clean up nested layout
+// folders such as Images/2023/01 after an undo.
+func pruneEmptyParents(dir, root string) {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return
+	}
+	for {
+		abs, err := filepath.Abs(dir)
+		if err != nil || abs == absRoot || !strings.HasPrefix(abs, absRoot+string(filepath.Separator)) {
+			return
+		}
+		if os.Remove(abs) != nil { // fails unless empty
+			return
+		}
+		dir = filepath.Dir(abs)
+	}
+}
@@ -0,0 +1,41 @@
+package organizer
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUndoVerifiesKeptCopy(t *testing.T) {
+	for _, force := range []bool{false, true} {
+		src, dst := t.TempDir(), t.TempDir()
+		writeTree(t, src, map[string]string{"a.txt": "same", "sub/a.txt": "same"})
+		sum := organize(t, src, dst, WithDedupe(DedupeDeleteSource))
+		if sum.Duplicates != 1 {
+			t.Fatalf("got %d duplicates, want 1", sum.Duplicates)
+		}
+		kept := filepath.Join(dst, "Docs", "a.txt")
+		if err := os.WriteFile(kept, []byte("edited"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := Undo(sum.Manifest, UndoOptions{Force: force, Out: io.Discard}); err != nil {
+			t.Fatal(err)
+		}
+
+		// The edited kept copy stays put, and the deleted duplicate is
+		// not recreated from it, unless forced
+		var restored int
+		for _, name := range []string{"a.txt", "sub/a.txt"} {
+			if exists(OS, filepath.Join(src, name)) {
+				restored++
+			}
+		}
+		switch {
+		case !force && (restored != 0 || !exists(OS, kept)):
+			t.Errorf("without force: restored %d file(s), want none", restored)
+		case force && restored != 2:
+			t.Errorf("with force: restored %d file(s), want 2", restored)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package organizer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Suffixes browsers and download managers use while a file is incomplete.
+// Such files are never queued; the final rename produces a fresh event.
+var partialSuffixes = []string{".part", ".partial", ".crdownload", ".download", ".opdownload", ".tmp"}
+
+func isPartialDownload(name string) bool {
+	lower := strings.ToLower(name)
+	for _, s := range partialSuffixes {
+		if strings.HasSuffix(lower, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// pendingFile is a file (or project directory) seen by the watcher that
+// hasn't settled yet.
+type pendingFile struct {
+	lastEvent time.Time
+	size      int64
+	modTime   time.Time
+	checked   bool // size/modTime have been sampled at least once
+}
+
+// watchSource watches srcDir (recursively) and queues files once they have
+// been quiet for settle and their size and mtime stopped changing. It
+// returns when ctx is cancelled; the caller closes jobs afterwards.
+func watchSource(ctx context.Context, srcDir string, cfg *config, settle time.Duration, jobs chan<- job, results chan<- result) error {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	addTree := func(root string) {
+		_ = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil || !info.IsDir() {
+				return nil
+			}
+			// With dst inside src, placed files are left alone, so
+			// their folders aren't watched either
+			if path != srcDir && (ownDir(info.Name()) || cfg.ignore.skipDir(path) || cfg.filter.skipDir(path) || categorizedDir(cfg, path)) {
+				return filepath.SkipDir
+			}
+			if path != srcDir && cfg.projects.isProject(cfg.fs, path) {
+				return filepath.SkipDir
+			}
+			if err := w.Add(path); err != nil {
+				results <- result{srcPath: path, err: fmt.Errorf("watch: %w", err)}
+			}
+			return nil
+		})
+	}
+	addTree(srcDir)
+
+	pending := make(map[string]*pendingFile)
+	tick := time.NewTicker(max(settle/2, 250*time.Millisecond))
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case err, ok := <-w.Errors:
+			if !ok {
+				return nil
+			}
+			results <- result{srcPath: srcDir, err: fmt.Errorf("watch: %w", err)}
+
+		case ev, ok := <-w.Events:
+			if !ok {
+				return nil
+			}
+			ev.Name = filepath.Clean(ev.Name)
+			if ev.Has(fsnotify.Remove) || ev.Has(fsnotify.Rename) {
+				delete(pending, ev.Name)
+				continue
+			}
+			if !ev.Has(fsnotify.Create) && !ev.Has(fsnotify.Write) {
+				continue
+			}
+			info, err := cfg.fs.Lstat(ev.Name)
+			if err != nil {
+				continue
+			}
+			if info.IsDir() {
+				if ev.Has(fsnotify.Create) {
+					// A directory moved or created in: watch it and pick up
+					// whatever it already contains. Projects inside it are
+					// queued whole once their tree stops changing.
+					addTree(ev.Name)
+					_ = filepath.Walk(ev.Name, func(path string, fi os.FileInfo, err error) error {
+						if err != nil {
+							return nil
+						}
+						if fi.IsDir() {
+							if ownDir(fi.Name()) || cfg.ignore.skipDir(path) || categorizedDir(cfg, path) {
+								return filepath.SkipDir
+							}
+							if cfg.projects.isProject(cfg.fs, path) {
+								pending[path] = &pendingFile{lastEvent: time.Now()}
+								return filepath.SkipDir
+							}
+							return nil
+						}
+						pending[path] = &pendingFile{lastEvent: time.Now()}
+						return nil
+					})
+				}
+				continue
+			}
+			if p, ok := pending[ev.Name]; ok {
+				p.lastEvent = time.Now()
+			} else {
+				pending[ev.Name] = &pendingFile{lastEvent: time.Now()}
+			}
+
+		case now := <-tick.C:
+			for path, p := range pending {
+				if now.Sub(p.lastEvent) < settle {
+					continue
+				}
+				info, err := cfg.fs.Lstat(path)
+				if err != nil {
+					delete(pending, path)
+					continue
+				}
+				size, modTime := info.Size(), info.ModTime()
+				if info.IsDir() {
+					size, modTime = treeStamp(cfg.fs, path)
+				}
+				// Still growing (or first look): sample again after another settle period.
+				if !p.checked || size != p.size || !modTime.Equal(p.modTime) {
+					p.size, p.modTime, p.checked = size, modTime, true
+					p.lastEvent = now
+					continue
+				}
+				delete(pending, path)
+				if info.IsDir() {
+					if _, queue := projectAt(cfg, path, info); !queue || cfg.ignore.skipDir(path) || skipProject(cfg, path, info) {
+						continue
+					}
+				} else if dir := projectAncestor(cfg, srcDir, path); dir != "" {
+					// The directory became a project after we started
+					// watching it (git clone, npm init): move it whole.
+					if _, ok := pending[dir]; !ok {
+						pending[dir] = &pendingFile{lastEvent: now}
+					}
+					continue
+				} else if skipFile(cfg, path, info) || isPartialDownload(info.Name()) {
+					continue
+				}
+				j := job{srcPath: path, info: info}
+				if !info.IsDir() {
+					// A sidecar waits for its primary; a primary takes
+					// its sidecars along, settled or not.
+					dir := filepath.Dir(path)
+					g := sidecarGroupsIn(cfg, dir)
+					if p, ok := g.primary[info.Name()]; ok {
+						if _, waiting := pending[filepath.Join(dir, p)]; waiting {
+							continue
+						}
+					}
+					j.sidecars = g.sidecarJobs(cfg.fs, dir, info.Name())
+					for _, s := range j.sidecars {
+						delete(pending, s.srcPath)
+					}
+				}
+				select {
+				case jobs <- j:
+					cfg.discovered(j)
+				case <-ctx.Done():
+					return nil
+				}
+			}
+		}
+	}
+}
+
+// treeStamp sums the file sizes and finds the newest mtime under dir, so a
+// project directory still being copied in keeps looking unsettled.
+func treeStamp(fsys FS, dir string) (size int64, newest time.Time) {
+	_ = fsys.Walk(dir, func(_ string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if fi.Mode().IsRegular() {
+			size += fi.Size()
+		}
+		if fi.ModTime().After(newest) {
+			newest = fi.ModTime()
+		}
+		return nil
+	})
+	return size, newest
+}
+
+// treeInfo is a directory's FileInfo with the size and mtime of its whole
+// tree, as treeStamp measures them.
+type treeInfo struct {
+	os.FileInfo
+	size    int64
+	modTime time.Time
+}
+
+func (i treeInfo) Size() int64        { return i.size }
+func (i treeInfo) ModTime() time.Time { return i.modTime }
+
+// projectAncestor returns the outermost project directory between srcDir
+// and path, or "".
+func projectAncestor(cfg *config, srcDir, path string) string {
+	if cfg.projects == nil {
+		return ""
+	}
+	root := filepath.Clean(srcDir)
+	found := ""
+	for d := filepath.Dir(path); d != root && d != filepath.Dir(d); d = filepath.Dir(d) {
+		if cfg.projects.isProject(cfg.fs, d) {
+			found = d
+		}
+	}
+	return found
+}
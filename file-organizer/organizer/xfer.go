@@ -0,0 +1,119 @@
+package organizer
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Verification failures of copyVerified.
+var (
+	errSourceChanged = errors.New("source changed during copy")
+	errChecksum      = errors.New("checksum mismatch")
+)
+
+// stagingPattern names the temp files and folders copies are built in
+// next to their destination before being renamed into place.
+const stagingPattern = ".organizer-*.tmp"
+
+// copyVerified copies src to dst the careful way for cross-device moves:
+// it writes a temp file in dst's directory, fsyncs it, re-reads it to check
+// the SHA-256 against what was read from src, carries over mode,
+// timestamps, ownership and xattrs, and only then renames it into place.
+// dst is never left half-written.
+func copyVerified(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	before, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(dst), stagingPattern)
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	committed := false
+	defer func() {
+		if !committed {
+			_ = tmp.Close()
+			_ = os.Remove(tmpPath)
+		}
+	}()
+
+	srcHash := sha256.New()
+	if _, err := io.Copy(tmp, io.TeeReader(in, srcHash)); err != nil {
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		return err
+	}
+
+	// The source must not have changed while we were reading it.
+	after, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	if after.Size() != before.Size() || !after.ModTime().Equal(before.ModTime()) {
+		return fmt.Errorf("%s: %w", src, errSourceChanged)
+	}
+
+	// Read back what actually reached the disk.
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	dstHash := sha256.New()
+	if _, err := io.Copy(dstHash, tmp); err != nil {
+		return err
+	}
+	if string(srcHash.Sum(nil)) != string(dstHash.Sum(nil)) {
+		return fmt.Errorf("%w copying %s to %s", errChecksum, src, dst)
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := preserveMetadata(src, tmpPath, before); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, dst); err != nil {
+		return err
+	}
+	committed = true
+	syncDir(filepath.Dir(dst))
+	return nil
+}
+
+// preserveMetadata copies permissions, ownership, xattrs and timestamps
+// from src to dst. Timestamps go last since the others can touch ctime/mtime.
+func preserveMetadata(src, dst string, info os.FileInfo) error {
+	if err := os.Chmod(dst, info.Mode().Perm()); err != nil {
+		return err
+	}
+	if err := copyOwnership(info, dst); err != nil {
+		return err
+	}
+	if err := copyXattrs(src, dst); err != nil {
+		return err
+	}
+	return os.Chtimes(dst, accessTime(info), info.ModTime())
+}
+
+// syncDir makes a rename in dir durable. Not every platform supports
+// fsync on directories, so failures are ignored.
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	_ = d.Sync()
+	_ = d.Close()
+}
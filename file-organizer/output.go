@@ -0,0 +1,242 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"file-organizer/organizer"
+)
+
+// Formats for --output.
+const (
+	outputText   = "text"   // human-readable lines (default)
+	outputJSON   = "json"   // one document with every event and the summary, at the end
+	outputNDJSON = "ndjson" // one event per line as it happens, then the summary
+)
+
+func validOutput(f string) bool {
+	return f == outputText || f == outputJSON || f == outputNDJSON
+}
+
+// event is the machine-readable form of one result.
+type event struct {
+	Type       string  `json:"type"` // always "file"
+	Action     string  `json:"action"`
+	Src        string  `json:"src"`
+	Dst        string  `json:"dst,omitempty"`
+	DupOf      string  `json:"dup_of,omitempty"`
+	Renamed    string  `json:"renamed_from,omitempty"`
+	Bytes      int64   `json:"bytes"`
+	DurationMs float64 `json:"duration_ms"`
+	DryRun     bool    `json:"dry_run,omitempty"`
+	Note       string  `json:"note,omitempty"`
+	Error      string  `json:"error,omitempty"`
+	Code       string  `json:"code,omitempty"`
+}
+
+// runSummary closes every run; Placed counts moved, copied or linked files
+// depending on Mode.
+type runSummary struct {
+	Type       string  `json:"type"` // always "summary"
+	Mode       string  `json:"mode"`
+	DryRun     bool    `json:"dry_run"`
+	Placed     int     `json:"placed"`
+	Skipped    int     `json:"skipped"`
+	Failed     int     `json:"failed"`
+	Duplicates int     `json:"duplicates"`
+	Expired    int     `json:"expired,omitempty"`
+	Extracted  int     `json:"extracted,omitempty"`
+	Bytes      int64   `json:"bytes"`
+	DurationMs float64 `json:"duration_ms"`
+	Manifest   string  `json:"manifest,omitempty"`
+	// Interrupted is set when a signal stopped the run before all work
+	// was done; the counts cover what completed.
+	Interrupted bool `json:"interrupted,omitempty"`
+}
+
+// reporter turns organizer events into console lines or JSON events.
+// The organizer calls add from a single goroutine.
+type reporter struct {
+	format  string
+	dryRun  bool
+	dedupe  bool // always show the duplicates counter
+	verbose bool // with a progress line, still print a line per file
+	out     io.Writer
+	log     io.Writer  // notes that aren't events; stderr unless text
+	bar     *progress  // live progress line, text output on a terminal only
+	report  *runReport // for --report, or nil
+
+	tag, dryTag, counter string
+
+	mode   string
+	enc    *json.Encoder
+	events []event
+}
+
+func newReporter(format, mode string, dryRun, dedupe bool) *reporter {
+	rp := &reporter{format: format, dryRun: dryRun, dedupe: dedupe, mode: mode, out: os.Stdout, log: os.Stdout}
+	rp.tag, rp.dryTag, rp.counter = modeVerb(mode)
+	if format != outputText {
+		rp.log = os.Stderr
+		rp.enc = json.NewEncoder(rp.out)
+	}
+	return rp
+}
+
+// showProgress replaces the per-file lines (unless verbose) with a live
+// progress line on out, through which everything else is printed too.
+func (rp *reporter) showProgress(out *os.File) {
+	rp.bar = newProgress(out)
+	rp.out, rp.log = rp.bar, rp.bar
+}
+
+// discover is organizer.OnDiscover for the progress line.
+func (rp *reporter) discover(path string, size int64) {
+	if rp.bar != nil {
+		rp.bar.discover(path, size)
+	}
+}
+
+// logf prints a note such as "Manifest saved" without mixing it into
+// machine-readable output.
+func (rp *reporter) logf(format string, a ...any) {
+	fmt.Fprintf(rp.log, format+"\n", a...)
+}
+
+// add reports one event.
+func (rp *reporter) add(e organizer.Event) {
+	if rp.report != nil {
+		rp.report.add(e)
+	}
+	ev := event{Type: "file", Action: e.Action, Src: e.Src, Dst: e.Dst, DupOf: e.DupOf, Renamed: e.Renamed,
+		Bytes: e.Bytes, DurationMs: ms(e.Elapsed), DryRun: e.DryRun, Note: e.Note}
+	switch {
+	case e.Err != nil:
+		ev.Action, ev.Error, ev.Code = "error", e.Err.Error(), organizer.ErrorCode(e.Err)
+	case e.Action == organizer.ActionPlace:
+		ev.Action = rp.mode
+	case e.Action == organizer.ActionSkip, e.Action == organizer.ActionExpire, e.Action == organizer.ActionExtract,
+		e.Action == organizer.ActionTrash, organizer.IsDuplicateAction(e.Action):
+	default:
+		return
+	}
+
+	switch rp.format {
+	case outputNDJSON:
+		_ = rp.enc.Encode(ev)
+	case outputJSON:
+		rp.events = append(rp.events, ev)
+	default:
+		if rp.bar != nil {
+			rp.bar.add(e)
+			if !rp.verbose && e.Err == nil {
+				return
+			}
+		}
+		rp.printText(e)
+	}
+}
+
+func (rp *reporter) printText(e organizer.Event) {
+	switch {
+	case e.Err != nil:
+		fmt.Fprintf(rp.out, "ERROR  %s -> %s  (%v)\n", e.Src, e.Dst, e.Err)
+	case e.Action == organizer.ActionPlace:
+		if rp.dryRun {
+			fmt.Fprintf(rp.out, "%s %s -> %s\n", rp.dryTag, e.Src, e.Dst)
+		} else if e.Note != "" {
+			fmt.Fprintf(rp.out, "%s %s -> %s (%s)\n", rp.tag, e.Src, e.Dst, e.Note)
+		} else {
+			fmt.Fprintf(rp.out, "%s %s -> %s\n", rp.tag, e.Src, e.Dst)
+		}
+	case e.Action == organizer.ActionExpire:
+		if rp.dryRun {
+			fmt.Fprintf(rp.out, "DRYRUN EXPIRE %s -> %s (%s)\n", e.Src, e.Dst, e.Note)
+		} else {
+			fmt.Fprintf(rp.out, "EXPIRE %s -> %s (%s)\n", e.Src, e.Dst, e.Note)
+		}
+	case e.Action == organizer.ActionExtract:
+		if rp.dryRun {
+			fmt.Fprintf(rp.out, "DRYRUN EXTRACT %s -> %s (%s)\n", e.Src, e.Dst, e.Note)
+		} else {
+			fmt.Fprintf(rp.out, "EXTRACTED %s -> %s (%s)\n", e.Src, e.Dst, e.Note)
+		}
+	case e.Action == organizer.ActionTrash:
+		if rp.dryRun {
+			fmt.Fprintf(rp.out, "DRYRUN TRASH %s -> %s (%s)\n", e.Src, e.Dst, e.Note)
+		} else {
+			fmt.Fprintf(rp.out, "TRASHED %s -> %s (%s)\n", e.Src, e.Dst, e.Note)
+		}
+	case e.Action == organizer.ActionSkip:
+		if e.Note != "" {
+			fmt.Fprintf(rp.out, "SKIP   %s (%s)\n", e.Src, e.Note)
+		} else {
+			fmt.Fprintf(rp.out, "SKIP   %s\n", e.Src)
+		}
+	default:
+		if rp.dryRun {
+			fmt.Fprintf(rp.out, "DRYRUN DUPE %s == %s (%s)\n", e.Src, e.DupOf, e.Action)
+		} else {
+			fmt.Fprintf(rp.out, "DUPE   %s == %s (%s)\n", e.Src, e.DupOf, e.Action)
+		}
+	}
+}
+
+// finish writes the summary (and, for json, everything collected).
+func (rp *reporter) finish(s *organizer.Summary) {
+	if rp.bar != nil {
+		rp.bar.finish()
+	}
+	sum := runSummary{Type: "summary", Mode: rp.mode, DryRun: rp.dryRun, Placed: s.Placed, Skipped: s.Skipped, Failed: s.Failed,
+		Duplicates: s.Duplicates, Expired: s.Expired, Extracted: s.Extracted, Bytes: s.Bytes, DurationMs: ms(s.Elapsed), Manifest: s.Manifest, Interrupted: s.Interrupted}
+	switch rp.format {
+	case outputNDJSON:
+		_ = rp.enc.Encode(sum)
+	case outputJSON:
+		if rp.events == nil {
+			rp.events = []event{}
+		}
+		rp.enc.SetIndent("", "  ")
+		_ = rp.enc.Encode(struct {
+			Events  []event    `json:"events"`
+			Summary runSummary `json:"summary"`
+		}{rp.events, sum})
+	default:
+		head := "Done in"
+		if s.Interrupted {
+			head = "Interrupted after"
+		}
+		fmt.Fprintf(rp.out, "\n%s %s | %s=%d skipped=%d failed=%d", head, s.Elapsed.Truncate(time.Millisecond), rp.counter, s.Placed, s.Skipped, s.Failed)
+		if rp.dedupe || s.Duplicates > 0 {
+			fmt.Fprintf(rp.out, " duplicates=%d", s.Duplicates)
+		}
+		if s.Extracted > 0 {
+			fmt.Fprintf(rp.out, " extracted=%d", s.Extracted)
+		}
+		if s.Expired > 0 {
+			fmt.Fprintf(rp.out, " expired=%d", s.Expired)
+		}
+		fmt.Fprintln(rp.out)
+	}
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// modeVerb is how results are labelled per mode: the console tag for a
+// completed file, the dry-run tag, and the summary counter name.
+func modeVerb(mode string) (tag, dryTag, counter string) {
+	switch mode {
+	case organizer.ModeCopy:
+		return "COPIED", "DRYRUN COPY", "copied"
+	case organizer.ModeSymlink:
+		return "SYMLINKED", "DRYRUN SYMLINK", "symlinked"
+	case organizer.ModeHardlink:
+		return "LINKED", "DRYRUN HARDLINK", "hardlinked"
+	}
+	return "MOVED ", "DRYRUN", "moved"
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"file-organizer/organizer"
+)
+
+// progressInterval is how often the progress line is redrawn.
+const progressInterval = 200 * time.Millisecond
+
+// progress draws a live status line on a terminal: files and bytes done
+// out of those discovered so far, throughput, ETA and per-category counts.
+// The walker feeds it through discover and the reporter through add.
+//
+// It is also the writer for everything else printed meanwhile, so lines
+// appear above the status line instead of through it.
+type progress struct {
+	out *os.File
+
+	mu         sync.Mutex
+	start      time.Time
+	files      int64 // discovered
+	bytes      int64
+	doneFiles  int64
+	doneBytes  int64
+	unsized    map[string]bool // projects: sized by their event
+	categories map[string]int
+	drawn      bool // the status line is on screen
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newProgress(out *os.File) *progress {
+	p := &progress{out: out, start: time.Now(), unsized: make(map[string]bool), categories: make(map[string]int),
+		stop: make(chan struct{}), done: make(chan struct{})}
+	go p.loop()
+	return p
+}
+
+func (p *progress) loop() {
+	defer close(p.done)
+	t := time.NewTicker(progressInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			p.mu.Lock()
+			p.draw()
+			p.mu.Unlock()
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+// discover counts a file or project queued by the organizer.
+func (p *progress) discover(path string, size int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.files++
+	if size < 0 {
+		p.unsized[path] = true
+	} else {
+		p.bytes += size
+	}
+}
+
+// add counts a finished file.
+func (p *progress) add(e organizer.Event) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.unsized[e.Src] {
+		delete(p.unsized, e.Src)
+		p.bytes += e.Bytes
+	}
+	p.doneFiles++
+	p.doneBytes += e.Bytes
+	if e.Err == nil && e.Action == organizer.ActionPlace && e.Category != "" {
+		p.categories[e.Category]++
+	}
+}
+
+// Write prints b above the status line.
+func (p *progress) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.clear()
+	return p.out.Write(b)
+}
+
+// finish removes the status line for good.
+func (p *progress) finish() {
+	close(p.stop)
+	<-p.done
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.clear()
+}
+
+func (p *progress) clear() {
+	if p.drawn {
+		fmt.Fprint(p.out, "\r\033[K")
+		p.drawn = false
+	}
+}
+
+func (p *progress) draw() {
+	files, bytes := max(p.files, p.doneFiles), max(p.bytes, p.doneBytes)
+	frac := 0.0
+	switch {
+	case bytes > 0:
+		frac = float64(p.doneBytes) / float64(bytes)
+	case files > 0:
+		frac = float64(p.doneFiles) / float64(files)
+	}
+
+	const barWidth = 20
+	filled := int(frac * barWidth)
+	line := fmt.Sprintf("%3.0f%% [%s%s] %d/%d files  %s/%s",
+		frac*100, strings.Repeat("#", filled), strings.Repeat(".", barWidth-filled),
+		p.doneFiles, files, formatBytes(p.doneBytes), formatBytes(bytes))
+
+	elapsed := time.Since(p.start)
+	if rate := float64(p.doneBytes) / elapsed.Seconds(); p.doneBytes > 0 {
+		line += fmt.Sprintf("  %s/s", formatBytes(int64(rate)))
+		if frac > 0 && frac < 1 {
+			eta := time.Duration(float64(elapsed) * (1 - frac) / frac)
+			line += "  ETA " + eta.Round(time.Second).String()
+		}
+	}
+	if len(p.categories) > 0 {
+		line += "  " + formatCategoryCounts(p.categories)
+	}
+
+	if r, w := []rune(line), termWidth(p.out); len(r) >= w {
+		line = string(r[:w-1])
+	}
+	fmt.Fprint(p.out, "\r\033[K"+line)
+	p.drawn = true
+}
+
+// formatCategoryCounts lists categories by count, largest first.
+func formatCategoryCounts(counts map[string]int) string {
+	names := make([]string, 0, len(counts))
+	for c := range counts {
+		names = append(names, c)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if counts[names[i]] != counts[names[j]] {
+			return counts[names[i]] > counts[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	parts := make([]string, len(names))
+	for i, c := range names {
+		parts[i] = fmt.Sprintf("%s %d", c, counts[c])
+	}
+	return strings.Join(parts, " · ")
+}
+
+// formatBytes prints a byte count with a binary unit, matching the sizes
+// organizer.ParseSize accepts (1KB = 1024 bytes).
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,363 @@
+package main
+
+import (
+	"encoding/csv"
+	"html/template"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"file-organizer/organizer"
+)
+
+// reportLargest is how many of the largest placed files a report lists.
+const reportLargest = 20
+
+// validReport reports whether --report names a format we can write,
+// which is picked by extension.
+func validReport(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".html", ".htm", ".csv":
+		return true
+	}
+	return false
+}
+
+// runReport collects what a run did for --report: an HTML page or a CSV
+// file to hand to people who won't read console output.
+type runReport struct {
+	categories map[string]*reportCategory
+	largest    []organizer.Event // placed files, largest first
+	conflicts  []organizer.Event // placed under a new name
+	errors     map[string][]organizer.Event
+}
+
+type reportCategory struct {
+	Name  string
+	Files int
+	Bytes int64
+}
+
+type reportErrors struct {
+	Code, Cause string
+	Events      []organizer.Event
+}
+
+func newRunReport() *runReport {
+	return &runReport{categories: make(map[string]*reportCategory), errors: make(map[string][]organizer.Event)}
+}
+
+// add records one event.
+func (rr *runReport) add(e organizer.Event) {
+	switch {
+	case e.Err != nil:
+		code := organizer.ErrorCode(e.Err)
+		rr.errors[code] = append(rr.errors[code], e)
+		return
+	case e.Action != organizer.ActionPlace:
+		return
+	}
+	c, ok := rr.categories[e.Category]
+	if !ok {
+		c = &reportCategory{Name: e.Category}
+		rr.categories[e.Category] = c
+	}
+	c.Files++
+	c.Bytes += e.Bytes
+	if e.Renamed != "" {
+		rr.conflicts = append(rr.conflicts, e)
+	}
+
+	// Keep only the largest few, in order
+	i := sort.Search(len(rr.largest), func(i int) bool { return rr.largest[i].Bytes < e.Bytes })
+	if i < reportLargest {
+		rr.largest = append(rr.largest, organizer.Event{})
+		copy(rr.largest[i+1:], rr.largest[i:])
+		rr.largest[i] = e
+		if len(rr.largest) > reportLargest {
+			rr.largest = rr.largest[:reportLargest]
+		}
+	}
+}
+
+// reportData is what both formats are written from.
+type reportData struct {
+	Generated   time.Time
+	Source      string
+	Dest        string
+	Mode        string
+	DryRun      bool
+	Summary     *organizer.Summary
+	Categories  []*reportCategory
+	Largest     []organizer.Event
+	Conflicts   []organizer.Event
+	Errors      []reportErrors
+	Manifest    string       // absolute path, or "" if nothing was recorded
+	ManifestURL template.URL // relative to the report when possible
+	UndoCommand string
+}
+
+func (rr *runReport) data(src, dst, mode string, dryRun bool, sum *organizer.Summary) reportData {
+	d := reportData{Generated: time.Now(), Source: absOrSelf(src), Dest: absOrSelf(dst), Mode: mode, DryRun: dryRun,
+		Summary: sum, Largest: rr.largest, Conflicts: rr.conflicts}
+	for _, c := range rr.categories {
+		d.Categories = append(d.Categories, c)
+	}
+	sort.Slice(d.Categories, func(i, j int) bool {
+		if d.Categories[i].Bytes != d.Categories[j].Bytes {
+			return d.Categories[i].Bytes > d.Categories[j].Bytes
+		}
+		return d.Categories[i].Name < d.Categories[j].Name
+	})
+	for code, evs := range rr.errors {
+		d.Errors = append(d.Errors, reportErrors{Code: code, Cause: errorCause(code), Events: evs})
+	}
+	sort.Slice(d.Errors, func(i, j int) bool {
+		if len(d.Errors[i].Events) != len(d.Errors[j].Events) {
+			return len(d.Errors[i].Events) > len(d.Errors[j].Events)
+		}
+		return d.Errors[i].Code < d.Errors[j].Code
+	})
+	if sum.Manifest != "" {
+		d.Manifest = absOrSelf(sum.Manifest)
+		d.UndoCommand = filepath.Base(os.Args[0]) + " -undo " + shellQuote(d.Manifest)
+	}
+	return d
+}
+
+// shellQuote quotes s for a POSIX shell, so the undo command can be
+// pasted as is whatever the manifest path contains.
+func shellQuote(s string) string {
+	if s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_./+:,@%=") == "" {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// writeReport saves a report to path, as HTML or CSV by its extension.
+func writeReport(path string, d reportData) error {
+	if d.Manifest != "" {
+		// A relative link survives the report and the destination being
+		// shared or moved together
+		u := &url.URL{Scheme: "file", Path: filepath.ToSlash(d.Manifest)}
+		if rel, err := filepath.Rel(filepath.Dir(absOrSelf(path)), d.Manifest); err == nil {
+			u = &url.URL{Path: filepath.ToSlash(rel)}
+		}
+		d.ManifestURL = template.URL(u.String())
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if strings.ToLower(filepath.Ext(path)) == ".csv" {
+		err = writeReportCSV(f, d)
+	} else {
+		err = reportHTML.Execute(f, d)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// writeReportCSV writes one table; the section column says what each row
+// is so it can be filtered in a spreadsheet.
+func writeReportCSV(out io.Writer, d reportData) error {
+	w := csv.NewWriter(out)
+	row := func(rec ...string) { _ = w.Write(rec) }
+	n := strconv.Itoa
+	b := func(v int64) string { return strconv.FormatInt(v, 10) }
+
+	row("section", "name", "files", "bytes", "source", "destination", "detail")
+	s := d.Summary
+	row("summary", "generated", "", "", "", "", d.Generated.Format(time.RFC3339))
+	row("summary", "mode", "", "", d.Source, d.Dest, d.Mode+dryRunSuffix(d.DryRun))
+	row("summary", "placed", n(s.Placed), b(s.Bytes), "", "", "")
+	row("summary", "skipped", n(s.Skipped), "", "", "", "")
+	row("summary", "duplicates", n(s.Duplicates), "", "", "", "")
+	row("summary", "expired", n(s.Expired), "", "", "", "")
+	row("summary", "extracted", n(s.Extracted), "", "", "", "")
+	row("summary", "failed", n(s.Failed), "", "", "", "")
+	row("summary", "elapsed", "", "", "", "", s.Elapsed.Truncate(time.Millisecond).String())
+	if d.Manifest != "" {
+		row("summary", "manifest", "", "", "", d.Manifest, "undo with: "+d.UndoCommand)
+	}
+	for _, c := range d.Categories {
+		row("category", c.Name, n(c.Files), b(c.Bytes), "", "", "")
+	}
+	for _, e := range d.Largest {
+		row("largest", e.Category, "", b(e.Bytes), e.Src, e.Dst, "")
+	}
+	for _, e := range d.Conflicts {
+		row("renamed", e.Category, "", b(e.Bytes), e.Src, e.Dst, "name taken: "+e.Renamed)
+	}
+	for _, g := range d.Errors {
+		for _, e := range g.Events {
+			row("error", g.Code, "", "", e.Src, e.Dst, g.Cause+": "+e.Err.Error())
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// errorCause explains an organizer.ErrorCode in plain words.
+func errorCause(code string) string {
+	switch code {
+	case "not_found":
+		return "The file disappeared before it could be organized"
+	case "permission_denied":
+		return "Permission denied"
+	case "exists":
+		return "Something already exists at the destination"
+	case "no_space":
+		return "The disk is full"
+	case "cross_device":
+		return "The file could not be moved to another disk"
+	case "read_only":
+		return "The disk is read-only"
+	case "name_too_long":
+		return "The file name is too long"
+	case "not_empty":
+		return "A folder that had to be replaced is not empty"
+	case "checksum_mismatch":
+		return "The copy did not match the original and was discarded"
+	case "source_changed":
+		return "The file changed while it was being copied"
+	case "journal":
+		return "The manifest could not be written, so nothing was changed"
+	case "stale":
+		return "The file changed since the plan was made"
+	case "unsafe_archive":
+		return "The archive was not unpacked: it reaches outside its folder or is far too large"
+	case "bad_archive":
+		return "The archive is damaged or not what its name says"
+	case "io_error":
+		return "A disk or filesystem error"
+	}
+	return "Other errors"
+}
+
+func dryRunSuffix(dryRun bool) string {
+	if dryRun {
+		return " (dry run: nothing was changed)"
+	}
+	return ""
+}
+
+func absOrSelf(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
+
+var reportHTML = template.Must(template.New("report").Funcs(template.FuncMap{
+	"bytes":  formatBytes,
+	"when":   func(t time.Time) string { return t.Format("2006-01-02 15:04:05") },
+	"dryRun": dryRunSuffix,
+	"ms":     func(d time.Duration) string { return d.Truncate(time.Millisecond).String() },
+	"base":   filepath.Base,
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>File organizer report – {{when .Generated}}</title>
+<style>
+body { font: 15px/1.45 system-ui, sans-serif; margin: 2em auto; max-width: 64em; padding: 0 1em; color: #222; }
+h1 { font-size: 1.5em; } h2 { font-size: 1.15em; margin-top: 2em; }
+table { border-collapse: collapse; width: 100%; }
+th, td { text-align: left; padding: .3em .6em; border-bottom: 1px solid #ddd; vertical-align: top; }
+td.num, th.num { text-align: right; white-space: nowrap; }
+.cards { display: flex; gap: 1em; flex-wrap: wrap; }
+.card { border: 1px solid #ddd; border-radius: 6px; padding: .6em 1em; min-width: 7em; }
+.card b { display: block; font-size: 1.6em; }
+.failed b { color: #b00; }
+.path { font-family: ui-monospace, monospace; font-size: .9em; word-break: break-all; }
+.note { color: #666; }
+</style>
+</head>
+<body>
+<h1>File organizer report</h1>
+<p>{{when .Generated}}: {{.Mode}} from <span class="path">{{.Source}}</span> to <span class="path">{{.Dest}}</span>{{dryRun .DryRun}}.
+{{- if .Summary.Interrupted}} The run was interrupted; the numbers cover what was finished.{{end}}</p>
+
+<div class="cards">
+<div class="card"><b>{{.Summary.Placed}}</b>organized ({{bytes .Summary.Bytes}})</div>
+<div class="card"><b>{{.Summary.Skipped}}</b>skipped</div>
+<div class="card"><b>{{.Summary.Duplicates}}</b>duplicates</div>
+{{- if .Summary.Extracted}}
+<div class="card"><b>{{.Summary.Extracted}}</b>archives unpacked</div>
+{{- end}}
+{{- if .Summary.Expired}}
+<div class="card"><b>{{.Summary.Expired}}</b>expired to the trash</div>
+{{- end}}
+<div class="card{{if .Summary.Failed}} failed{{end}}"><b>{{.Summary.Failed}}</b>failed</div>
+<div class="card"><b>{{ms .Summary.Elapsed}}</b>taken</div>
+</div>
+
+<h2>Undo</h2>
+{{- if .Manifest}}
+<p>Every change was recorded in the manifest <a class="path" href="{{.ManifestURL}}">{{base .Manifest}}</a>.
+To put everything back, run:</p>
+<p class="path">{{.UndoCommand}}</p>
+{{- else}}
+<p class="note">Nothing was changed, so there is nothing to undo.</p>
+{{- end}}
+
+<h2>By category</h2>
+{{- if .Categories}}
+<table>
+<tr><th>Category</th><th class="num">Files</th><th class="num">Size</th></tr>
+{{- range .Categories}}
+<tr><td>{{.Name}}</td><td class="num">{{.Files}}</td><td class="num">{{bytes .Bytes}}</td></tr>
+{{- end}}
+</table>
+{{- else}}
+<p class="note">No files were organized.</p>
+{{- end}}
+
+{{- if .Largest}}
+<h2>Largest files</h2>
+<table>
+<tr><th>File</th><th>Now at</th><th class="num">Size</th></tr>
+{{- range .Largest}}
+<tr><td class="path">{{.Src}}</td><td class="path">{{.Dst}}</td><td class="num">{{bytes .Bytes}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+
+<h2>Renamed because the name was taken</h2>
+{{- if .Conflicts}}
+<p class="note">A file with the same name was already there, so these got a number added.</p>
+<table>
+<tr><th>File</th><th>Wanted</th><th>Now at</th></tr>
+{{- range .Conflicts}}
+<tr><td class="path">{{.Src}}</td><td class="path">{{.Renamed}}</td><td class="path">{{.Dst}}</td></tr>
+{{- end}}
+</table>
+{{- else}}
+<p class="note">None.</p>
+{{- end}}
+
+<h2>Problems</h2>
+{{- if .Errors}}
+{{- range .Errors}}
+<h3>{{.Cause}} ({{len .Events}})</h3>
+<table>
+<tr><th>File</th><th>Details</th></tr>
+{{- range .Events}}
+<tr><td class="path">{{.Src}}</td><td>{{.Err}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+{{- else}}
+<p class="note">None.</p>
+{{- end}}
+</body>
+</html>
+`))
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+
+	"file-organizer/organizer"
+)
+
+// runTrash carries out "trash list", "trash restore NAME..." and
+// "trash empty" on the trash under dstDir. Empty takes -older-than to
+// keep recently expired files.
+func runTrash(sub, dstDir string, args []string, olderThan string, dryRun bool, output string) {
+	switch sub {
+	case "list":
+		items, err := organizer.TrashItems(dstDir)
+		if err != nil {
+			exitf("%v", err)
+		}
+		printTrash(items, output)
+	case "restore":
+		if len(args) == 0 {
+			exitf("usage: %s trash restore [flags] name...", filepath.Base(os.Args[0]))
+		}
+		if err := organizer.RestoreTrash(dstDir, args, dryRun, os.Stdout); err != nil {
+			exitf("restore failed: %v", err)
+		}
+	case "empty":
+		before, err := organizer.ParseAgeCutoff(olderThan, time.Now())
+		if err != nil {
+			exitf("-older-than: %v", err)
+		}
+		if err := organizer.EmptyTrash(dstDir, before, dryRun, os.Stdout); err != nil {
+			exitf("empty failed: %v", err)
+		}
+	default:
+		exitf("unknown trash command %q (want list, restore or empty)", sub)
+	}
+}
+
+// printTrash lists trash items oldest first, as a table or JSON.
+func printTrash(items []organizer.TrashItem, output string) {
+	if output != outputText {
+		type item struct {
+			Name string `json:"name"`
+			organizer.TrashItem
+		}
+		out := make([]item, len(items))
+		for i, it := range items {
+			out[i] = item{it.Name, it}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(out)
+		return
+	}
+	if len(items) == 0 {
+		fmt.Println("The trash is empty.")
+		return
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tTRASHED\tSIZE\tCATEGORY\tORIGINAL")
+	var total int64
+	for _, it := range items {
+		original := it.Path
+		if original == "" {
+			original = "(unknown)"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", it.Name, it.Trashed.Local().Format("2006-01-02 15:04:05"),
+			formatBytes(it.Size), it.Category, original)
+		total += it.Size
+	}
+	_ = tw.Flush()
+	fmt.Printf("\n%d file(s), %s. Restore with: %s trash restore NAME\n", len(items), formatBytes(total), filepath.Base(os.Args[0]))
+}
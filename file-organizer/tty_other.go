@@ -0,0 +1,11 @@
+//go:build !linux && !darwin
+
+package main
+
+import "os"
+
+// The progress line is only drawn on Linux and macOS terminals.
+
+func isTerminal(f *os.File) bool { return false }
+
+func termWidth(f *os.File) int { return 80 }